@@ -47,3 +47,10 @@ func chain(middlewares []func(http.Handler) http.Handler, endpoint http.Handler)
 
 	return h
 }
+
+// compiledChain is a middleware chain built for one generation
+// of a Mux middleware stack.
+type compiledChain struct {
+	gen     uint64
+	handler http.Handler
+}
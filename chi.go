@@ -11,9 +11,7 @@ func NewRouter() *Mux {
 // using only the standard net/http.
 type Router interface {
 	http.Handler
-
-	// Middlewares returns the list of middlewares in use by the router.
-	Middlewares() Middlewares
+	Routes
 
 	// Use appends one or more middlewares onto the Router stack.
 	Use(middlewares ...func(http.Handler) http.Handler)
@@ -21,6 +19,18 @@ type Router interface {
 	// With adds inline middlewares for an endpoint handler.
 	With(middlewares ...func(http.Handler) http.Handler) Router
 
+	// Name returns an inline-Router naming the route registered on it,
+	// for building its URL with URL.
+	Name(name string) Router
+
+	// Meta returns an inline-Router attaching metadata to the routes
+	// registered on it, listed by Routes.
+	Meta(meta ...any) Router
+
+	// URL builds the URL path of a named route from its path values,
+	// given as key/value pairs.
+	URL(name string, params ...string) (string, error)
+
 	// Group adds a new inline-Router along the current routing
 	// path, with a fresh middleware stack for the inline-Router.
 	Group(fn func(r Router)) Router
@@ -28,6 +38,9 @@ type Router interface {
 	// Route mounts a sub-Router along a `pattern`` string.
 	Route(pattern string, fn func(r Router)) Router
 
+	// Host mounts a sub-Router serving the requests for a host `pattern`.
+	Host(pattern string, fn func(r Router)) Router
+
 	// Mount attaches another http.Handler along ./pattern/*
 	Mount(pattern string, h http.Handler)
 
@@ -51,6 +64,52 @@ type Router interface {
 	Post(pattern string, h http.HandlerFunc)
 	Put(pattern string, h http.HandlerFunc)
 	Trace(pattern string, h http.HandlerFunc)
+
+	// Register calls fn to register routes and returns all invalid
+	// registrations as a single error instead of panicking.
+	Register(fn func(r Router)) error
+
+	// TryHandle is like Handle, but returns an error for an invalid
+	// or conflicting pattern instead of panicking.
+	TryHandle(pattern string, h http.Handler) error
+
+	// NotFound defines a handler to respond whenever a route could
+	// not be found.
+	NotFound(h http.HandlerFunc)
+
+	// MethodNotAllowed defines a handler to respond whenever a method is
+	// not allowed.
+	MethodNotAllowed(h http.HandlerFunc)
+
+	// AutoOptions enables automatic responses to OPTIONS requests with
+	// the Allow header, `h` customises the response when not nil.
+	AutoOptions(h http.HandlerFunc)
+
+	// ErrorHandler sets the handler writing the errors returned by
+	// HandlerFuncE routes, inherited by subrouters.
+	ErrorHandler(h ErrorHandlerFunc)
+
+	// RegisterMethod adds support for custom HTTP methods on the router
+	// and its subrouters.
+	RegisterMethod(methods ...string)
+}
+
+// Routes interface adds two methods for router traversal.
+type Routes interface {
+	// Routes returns the routing tree in an easily traversable structure.
+	Routes() []Route
+
+	// Middlewares returns the list of middlewares in use by the router.
+	Middlewares() Middlewares
+
+	// Match searches the routing tree for a handler that matches
+	// the method/path - similar to routing a http request, but without
+	// executing the handler thereafter.
+	Match(method, path string) bool
+
+	// Find searches the routing tree for the pattern that matches
+	// the method/path and returns it with the captured path values.
+	Find(method, path string) (pattern string, params map[string]string)
 }
 
 // Middlewares type is a slice of standard middleware handlers with methods
@@ -0,0 +1,145 @@
+package stdchi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type routeCtxKey struct{}
+
+// routeCtx is the context of a request at one routing level, started by
+// the Mux serving it. A request handed down to a subrouter by Mount
+// continues the routing of the parent level, other requests, e.g.
+// dispatched again by a handler, start a new routing.
+//
+// The fields are set before the middlewares of the level run and aren't
+// modified afterwards, the outcome of the whole routing is kept in state.
+type routeCtx struct {
+	context.Context
+
+	state   *routeState
+	prefix  string         // full pattern of the mount point of the level
+	pattern string         // full pattern matched at this level
+	values  wildcardValues // path values captured up to this level
+	next    *Mux           // subrouter the request is handed down to
+	matched bool           // a route matched the request at this level
+
+	// fallback records the response of http.ServeMux when no route matched.
+	fallback fallbackRecorder
+
+	// root is the state of a request at its first routing level.
+	root routeState
+}
+
+// routeState is the outcome of the routing shared by all the levels of
+// a request, so middlewares of parent routers see the route matched by
+// the innermost subrouter after calling the next handler. It is guarded,
+// as a Timeout may report it while the request is still routed.
+type routeState struct {
+	mu      sync.Mutex
+	pattern string         // full pattern of the matched route
+	values  wildcardValues // path values captured so far
+	mux     *Mux           // router of the matched route
+}
+
+func (st *routeState) set(pattern string, values wildcardValues, mux *Mux) {
+	st.mu.Lock()
+	st.pattern, st.values, st.mux = pattern, values, mux
+	st.mu.Unlock()
+}
+
+func (st *routeState) get() (string, wildcardValues, *Mux) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.pattern, st.values, st.mux
+}
+
+func (rc *routeCtx) Value(key any) any {
+	if key == (routeCtxKey{}) {
+		return rc
+	}
+	return rc.Context.Value(key)
+}
+
+func routeCtxFromContext(ctx context.Context) *routeCtx {
+	rc, _ := ctx.Value(routeCtxKey{}).(*routeCtx)
+	return rc
+}
+
+// newRouteCtx returns the request with the routing level of mx in its
+// context, and the level.
+func (mx *Mux) newRouteCtx(r *http.Request) (*http.Request, *routeCtx) {
+	ctx := r.Context()
+	rc := &routeCtx{Context: ctx}
+	if parent := routeCtxFromContext(ctx); parent != nil && parent.next == mx {
+		rc.state, rc.prefix, rc.values = parent.state, parent.pattern, parent.values
+	} else {
+		rc.state = &rc.root
+		rc.values, _ = ctx.Value(wildcardCtx{}).(wildcardValues)
+	}
+	return r.WithContext(rc), rc
+}
+
+// match records the route matched at the routing level, with the values
+// of the wildcards named `wilds` and of a trailing `*` when `star` is set.
+// The values of the previous levels are copied, so they aren't modified.
+func (rc *routeCtx) match(r *http.Request, pattern string, wilds []string, star bool, mux *Mux) {
+	rc.pattern = joinPatterns(rc.prefix, pattern)
+	if len(wilds) > 0 || star {
+		values := make(wildcardValues, len(rc.values)+len(wilds)+1)
+		for k, v := range rc.values {
+			values[k] = v
+		}
+		for _, ws := range wilds {
+			values[ws] = r.PathValue(ws)
+		}
+		if star {
+			values["*"] = strings.TrimPrefix(stripToLastSlash(r.URL.Path, len(wildcards(pattern))), "/")
+		}
+		rc.values = values
+	}
+	rc.state.set(rc.pattern, rc.values, mux)
+}
+
+// RoutePattern returns the full route pattern matched for the request
+// across all Mount levels, e.g. `/sharing/{hash}/share/{network}`.
+//
+// Middlewares registered with Use see the full pattern after calling
+// the next handler, when the innermost subrouter has matched its route.
+func RoutePattern(ctx context.Context) string {
+	if rc := routeCtxFromContext(ctx); rc != nil {
+		pattern, _, _ := rc.state.get()
+		return pattern
+	}
+	return ""
+}
+
+// PathValues returns all the path values captured for the request along
+// all Mount and Host levels, keyed by wildcard name. The returned map is
+// a copy and may be modified.
+//
+// Middlewares registered with Use on a parent router see the values of
+// the innermost subrouter only after calling the next handler.
+func PathValues(r *http.Request) map[string]string {
+	wcs := wildcardsFromContext(r.Context())
+	values := make(map[string]string, len(wcs))
+	for k, v := range wcs {
+		values[k] = v
+	}
+	return values
+}
+
+// URLParam returns the url parameter from a http.Request object.
+func URLParam(r *http.Request, key string) string {
+	if v := r.PathValue(key); v != "" {
+		return v
+	}
+	return URLParamFromCtx(r.Context(), key)
+}
+
+// URLParamFromCtx returns the url parameter from a http.Request Context.
+func URLParamFromCtx(ctx context.Context, key string) string {
+	return wildcardsFromContext(ctx)[key]
+}
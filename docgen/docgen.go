@@ -0,0 +1,128 @@
+// Package docgen documents the routes of a stdchi router, with the
+// handlers and the middlewares applied at every Mount level, as JSON
+// or Markdown.
+package docgen
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/covrom/stdchi"
+)
+
+// Doc is the documentation of a router.
+type Doc struct {
+	Router DocRouter `json:"router"`
+}
+
+// DocRouter is a router or a mounted subrouter with the middlewares
+// registered on it with Use.
+type DocRouter struct {
+	Middlewares []DocMiddleware `json:"middlewares"`
+	Routes      DocRoutes       `json:"routes"`
+}
+
+// DocMiddleware is a middleware function.
+type DocMiddleware struct {
+	FuncInfo
+}
+
+// DocRoute is a route pattern with its handlers by method, or with the
+// subrouter mounted on it.
+type DocRoute struct {
+	Pattern  string      `json:"-"`
+	Handlers DocHandlers `json:"handlers,omitempty"`
+	Router   *DocRouter  `json:"router,omitempty"`
+}
+
+// DocRoutes lists the routes of a router by pattern.
+type DocRoutes map[string]DocRoute
+
+// DocHandler is the handler of a route for a method, with the inline
+// middlewares added with With and Group.
+type DocHandler struct {
+	Middlewares []DocMiddleware `json:"middlewares"`
+	Method      string          `json:"method"`
+	FuncInfo
+}
+
+// DocHandlers lists the handlers of a route by method, "*" for all methods.
+type DocHandlers map[string]DocHandler
+
+// BuildDoc returns the documentation of the routes of `r`, including the
+// routes of the subrouters attached with Mount, Route and Host.
+func BuildDoc(r stdchi.Routes) (Doc, error) {
+	return Doc{Router: buildDocRouter(r)}, nil
+}
+
+// JSONRoutesDoc returns the documentation of the routes of `r` as JSON.
+func JSONRoutesDoc(r stdchi.Routes) string {
+	doc, _ := BuildDoc(r)
+	v, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(v)
+}
+
+func buildDocRouter(r stdchi.Routes) DocRouter {
+	dr := DocRouter{Middlewares: []DocMiddleware{}, Routes: DocRoutes{}}
+	for _, mw := range r.Middlewares() {
+		dr.Middlewares = append(dr.Middlewares, DocMiddleware{FuncInfo: GetFuncInfo(mw)})
+	}
+
+	for _, rt := range r.Routes() {
+		drt := DocRoute{Pattern: rt.Pattern, Handlers: DocHandlers{}}
+
+		if rt.SubRoutes != nil {
+			sub := buildDocRouter(rt.SubRoutes)
+			drt.Router = &sub
+			// Inline middlewares of the mount point apply to the
+			// whole subrouter.
+			if h, ok := rt.Handlers["*"].(*stdchi.ChainHandler); ok {
+				drt.Handlers["*"] = DocHandler{Method: "*", Middlewares: docMiddlewares(h.Middlewares), FuncInfo: GetFuncInfo(h.Endpoint)}
+			}
+		} else {
+			for method, h := range rt.Handlers {
+				dh := DocHandler{Method: method, Middlewares: []DocMiddleware{}}
+				if ch, ok := h.(*stdchi.ChainHandler); ok {
+					dh.Middlewares = docMiddlewares(ch.Middlewares)
+					h = ch.Endpoint
+				}
+				dh.FuncInfo = GetFuncInfo(h)
+				drt.Handlers[method] = dh
+			}
+		}
+
+		dr.Routes[rt.Pattern] = drt
+	}
+	return dr
+}
+
+func docMiddlewares(mws stdchi.Middlewares) []DocMiddleware {
+	dms := make([]DocMiddleware, 0, len(mws))
+	for _, mw := range mws {
+		dms = append(dms, DocMiddleware{FuncInfo: GetFuncInfo(mw)})
+	}
+	return dms
+}
+
+// sortedPatterns returns the patterns of the routes in order.
+func (routes DocRoutes) sortedPatterns() []string {
+	patterns := make([]string, 0, len(routes))
+	for p := range routes {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// sortedMethods returns the methods of the handlers in order.
+func (handlers DocHandlers) sortedMethods() []string {
+	methods := make([]string, 0, len(handlers))
+	for m := range handlers {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
@@ -0,0 +1,92 @@
+package docgen
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/covrom/stdchi"
+	"github.com/covrom/stdchi/middleware"
+)
+
+// getUser returns a user.
+func getUser(w http.ResponseWriter, r *http.Request) {}
+
+func testRouter() stdchi.Router {
+	users := stdchi.NewRouter()
+	users.Use(middleware.NoCache)
+	users.Get("/{id}", getUser)
+	users.With(middleware.AllowContentType("application/json")).Post("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := stdchi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Get("/{$}", func(w http.ResponseWriter, r *http.Request) {})
+	r.With(middleware.RealIP).Mount("/users", users)
+	return r
+}
+
+func TestBuildDoc(t *testing.T) {
+	doc, err := BuildDoc(testRouter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := doc.Router
+	if len(root.Middlewares) != 1 || root.Middlewares[0].Func != "RequestID" ||
+		root.Middlewares[0].Pkg != "github.com/covrom/stdchi/middleware" {
+		t.Fatalf("unexpected middlewares %+v", root.Middlewares)
+	}
+	if h := root.Routes["/{$}"].Handlers["GET"]; !h.Anonymous || h.Func != "testRouter.func2" {
+		t.Fatalf("unexpected handler %+v", h)
+	}
+
+	mount := root.Routes["/users/"]
+	if mount.Router == nil || len(mount.Handlers["*"].Middlewares) != 1 || mount.Handlers["*"].Middlewares[0].Func != "RealIP" {
+		t.Fatalf("unexpected mount %+v", mount)
+	}
+	users := mount.Router
+	if len(users.Middlewares) != 1 || users.Middlewares[0].Func != "NoCache" {
+		t.Fatalf("unexpected middlewares %+v", users.Middlewares)
+	}
+	h := users.Routes["/{id}"].Handlers["GET"]
+	if h.Func != "getUser" || h.Comment != "getUser returns a user." || !strings.HasSuffix(h.File, "docgen_test.go") || h.Line == 0 {
+		t.Fatalf("unexpected handler %+v", h)
+	}
+	if h := users.Routes["/"].Handlers["POST"]; len(h.Middlewares) != 1 || h.Middlewares[0].Func != "AllowContentType.func1" {
+		t.Fatalf("unexpected handler %+v", h)
+	}
+
+	var v Doc
+	if err := json.Unmarshal([]byte(JSONRoutesDoc(testRouter())), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Router.Routes["/users/"].Router.Routes["/{id}"].Handlers["GET"].Func != "getUser" {
+		t.Fatalf("unexpected JSON doc %+v", v)
+	}
+}
+
+func TestMarkdownRoutesDoc(t *testing.T) {
+	md := MarkdownRoutesDoc(testRouter(), MarkdownOpts{
+		ProjectPath: "github.com/covrom/stdchi",
+		Intro:       "Welcome.",
+	})
+
+	for _, s := range []string{
+		"# Routing docs\n\nWelcome.\n\n## Routes\n\n",
+		"<details>\n<summary>`/users/{id}`</summary>\n\n" +
+			"- middleware.RequestID\n" +
+			"- **/users/**\n" +
+			"\t- middleware.RealIP\n" +
+			"\t- middleware.NoCache\n" +
+			"\t- **/{id}**\n" +
+			"\t\t- _GET_\n" +
+			"\t\t\t- docgen.getUser\n" +
+			"\n</details>\n",
+		"\t\t- _POST_\n\t\t\t- middleware.AllowContentType.func1\n\t\t\t- docgen.testRouter.func1\n",
+		"Total # of routes: 3\n",
+	} {
+		if !strings.Contains(md, s) {
+			t.Fatalf("expecting %q in:\n%s", s, md)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package docgen
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// FuncInfo locates a function in the source code.
+type FuncInfo struct {
+	Pkg          string `json:"pkg"`
+	Func         string `json:"func"`
+	Comment      string `json:"comment"`
+	File         string `json:"file,omitempty"`
+	Line         int    `json:"line,omitempty"`
+	Anonymous    bool   `json:"anonymous,omitempty"`
+	Unresolvable bool   `json:"unresolvable,omitempty"`
+}
+
+// GetFuncInfo resolves the function of a handler, a middleware or any
+// other func value with runtime.FuncForPC. Handlers that are not functions
+// are described by their type.
+func GetFuncInfo(i interface{}) FuncInfo {
+	fi := FuncInfo{}
+	v := reflect.ValueOf(i)
+	if !v.IsValid() {
+		fi.Unresolvable = true
+		return fi
+	}
+	if v.Kind() != reflect.Func {
+		t, ptr := v.Type(), ""
+		for t.Kind() == reflect.Pointer {
+			t, ptr = t.Elem(), ptr+"*"
+		}
+		fi.Pkg = t.PkgPath()
+		fi.Func = ptr + t.Name()
+		if _, ok := i.(http.Handler); !ok {
+			fi.Unresolvable = true
+		}
+		return fi
+	}
+
+	frame := runtime.FuncForPC(v.Pointer())
+	if frame == nil {
+		fi.Unresolvable = true
+		return fi
+	}
+
+	fi.Pkg, fi.Func = splitFuncName(frame.Name())
+	fi.File, fi.Line = frame.FileLine(v.Pointer())
+	fi.Anonymous = isAnonymous(fi.Func)
+	if !fi.Anonymous {
+		fi.Comment = funcComment(fi.File, fi.Line)
+	}
+	return fi
+}
+
+// splitFuncName splits a full function name, like
+// `github.com/covrom/stdchi/middleware.RequestID`, into the package path
+// and the function name.
+func splitFuncName(name string) (pkg, fn string) {
+	i := strings.LastIndexByte(name, '/')
+	j := strings.IndexByte(name[i+1:], '.')
+	if j < 0 {
+		return "", name
+	}
+	return name[:i+1+j], name[i+1+j+1:]
+}
+
+// isAnonymous reports whether a function name is the name of a closure,
+// like `main.main.func1`.
+func isAnonymous(fn string) bool {
+	i := strings.LastIndex(fn, ".func")
+	if i < 0 {
+		return false
+	}
+	for _, c := range fn[i+len(".func"):] {
+		if (c < '0' || c > '9') && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	sourceMu    sync.Mutex
+	sourceLines = map[string][]string{}
+)
+
+// funcComment returns the doc comment of the function declared at
+// `file`:`line`, when the source is available.
+func funcComment(file string, line int) string {
+	sourceMu.Lock()
+	lines, ok := sourceLines[file]
+	if !ok {
+		if b, err := os.ReadFile(file); err == nil {
+			lines = strings.Split(string(b), "\n")
+		}
+		sourceLines[file] = lines
+	}
+	sourceMu.Unlock()
+
+	// Look up the declaration from the reported line.
+	i := line - 1
+	for i >= 0 && i < len(lines) && !strings.HasPrefix(lines[i], "func ") {
+		i--
+	}
+	if i < 0 || i >= len(lines) {
+		return ""
+	}
+	var comment []string
+	for i--; i >= 0 && strings.HasPrefix(lines[i], "//"); i-- {
+		comment = append([]string{strings.TrimSpace(strings.TrimPrefix(lines[i], "//"))}, comment...)
+	}
+	return strings.Join(comment, "\n")
+}
+
+func (fi FuncInfo) String() string {
+	if fi.Pkg == "" {
+		return fi.Func
+	}
+	return fmt.Sprintf("%s.%s", fi.Pkg, fi.Func)
+}
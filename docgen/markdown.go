@@ -0,0 +1,140 @@
+package docgen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/covrom/stdchi"
+)
+
+// MarkdownOpts configures MarkdownRoutesDoc.
+type MarkdownOpts struct {
+	// ProjectPath is the base Go import path of the project,
+	// trimmed from the package paths.
+	ProjectPath string
+
+	// Title of the document, "Routing docs" when empty.
+	Title string
+
+	// Intro text printed below the title.
+	Intro string
+
+	// URLMap maps source file path prefixes to URLs, e.g. the local
+	// checkout of a module to its repository browser, to link the
+	// functions to their source. Functions are not linked when it's nil.
+	URLMap map[string]string
+}
+
+// MarkdownRoutesDoc returns the documentation of the routes of `r` as
+// Markdown. Every route gets a section listing, from the root router
+// down to its handler, the middlewares registered with Use at each
+// Mount level and the inline middlewares of With and Group.
+func MarkdownRoutesDoc(r stdchi.Routes, opts MarkdownOpts) string {
+	doc, _ := BuildDoc(r)
+	md := &mdBuilder{opts: opts}
+	md.writeDoc(doc)
+	return md.buf.String()
+}
+
+type mdBuilder struct {
+	buf  bytes.Buffer
+	opts MarkdownOpts
+}
+
+// mdLevel is a router level along the path to a route.
+type mdLevel struct {
+	router  *DocRouter
+	pattern string
+	mws     []DocMiddleware // inline middlewares of the mount point
+}
+
+func (md *mdBuilder) writeDoc(doc Doc) {
+	title := md.opts.Title
+	if title == "" {
+		title = "Routing docs"
+	}
+	fmt.Fprintf(&md.buf, "# %s\n\n", title)
+	if md.opts.Intro != "" {
+		fmt.Fprintf(&md.buf, "%s\n\n", md.opts.Intro)
+	}
+	md.buf.WriteString("## Routes\n\n")
+	md.writeRoutes(nil, &doc.Router, "")
+	fmt.Fprintf(&md.buf, "Total # of routes: %d\n", md.count(&doc.Router))
+}
+
+func (md *mdBuilder) writeRoutes(levels []mdLevel, dr *DocRouter, prefix string) {
+	for _, pattern := range dr.Routes.sortedPatterns() {
+		rt := dr.Routes[pattern]
+		full := strings.TrimSuffix(prefix, "/") + pattern
+		if rt.Router != nil {
+			level := mdLevel{router: dr, pattern: pattern}
+			if h, ok := rt.Handlers["*"]; ok {
+				level.mws = h.Middlewares
+			}
+			md.writeRoutes(append(levels[:len(levels):len(levels)], level), rt.Router, full)
+			continue
+		}
+
+		fmt.Fprintf(&md.buf, "<details>\n<summary>`%s`</summary>\n\n", full)
+		depth := 0
+		for _, l := range levels {
+			md.writeMiddlewares(depth, l.router.Middlewares)
+			fmt.Fprintf(&md.buf, "%s- **%s**\n", indent(depth), l.pattern)
+			depth++
+			md.writeMiddlewares(depth, l.mws)
+		}
+		md.writeMiddlewares(depth, dr.Middlewares)
+		fmt.Fprintf(&md.buf, "%s- **%s**\n", indent(depth), pattern)
+		for _, method := range rt.Handlers.sortedMethods() {
+			h := rt.Handlers[method]
+			fmt.Fprintf(&md.buf, "%s- _%s_\n", indent(depth+1), method)
+			md.writeMiddlewares(depth+2, h.Middlewares)
+			fmt.Fprintf(&md.buf, "%s- %s\n", indent(depth+2), md.funcLink(h.FuncInfo))
+		}
+		md.buf.WriteString("\n</details>\n")
+	}
+}
+
+func (md *mdBuilder) writeMiddlewares(depth int, mws []DocMiddleware) {
+	for _, mw := range mws {
+		fmt.Fprintf(&md.buf, "%s- %s\n", indent(depth), md.funcLink(mw.FuncInfo))
+	}
+}
+
+// funcLink returns the function name, linked to its source with URLMap.
+func (md *mdBuilder) funcLink(fi FuncInfo) string {
+	name := fi.String()
+	if md.opts.ProjectPath != "" {
+		name = strings.TrimPrefix(name, strings.TrimSuffix(md.opts.ProjectPath, "/")+"/")
+	}
+	if fi.File == "" || md.opts.URLMap == nil {
+		return name
+	}
+	best := ""
+	for prefix := range md.opts.URLMap {
+		if strings.HasPrefix(fi.File, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return name
+	}
+	return fmt.Sprintf("[%s](%s%s#L%d)", name, md.opts.URLMap[best], strings.TrimPrefix(fi.File, best), fi.Line)
+}
+
+func (md *mdBuilder) count(dr *DocRouter) int {
+	n := 0
+	for _, rt := range dr.Routes {
+		if rt.Router != nil {
+			n += md.count(rt.Router)
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func indent(depth int) string {
+	return strings.Repeat("\t", depth)
+}
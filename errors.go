@@ -0,0 +1,193 @@
+package stdchi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RouteError describes an invalid route registration.
+type RouteError struct {
+	// Method is the HTTP method of the route, empty for all methods.
+	Method string
+
+	// Pattern is the offending routing pattern.
+	Pattern string
+
+	// Existing is the pattern of the registered route the pattern
+	// conflicts with, prefixed by its method, e.g. `GET /users/{id:int}`.
+	Existing string
+
+	Err error
+}
+
+func (e *RouteError) Error() string { return e.Err.Error() }
+
+func (e *RouteError) Unwrap() error { return e.Err }
+
+// RegistrationError lists all the invalid route registrations
+// collected by Register.
+type RegistrationError struct {
+	Errors []*RouteError
+}
+
+func (e *RegistrationError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "stdchi: %d invalid route registrations:", len(e.Errors))
+	for _, re := range e.Errors {
+		sb.WriteString("\n\t")
+		sb.WriteString(strings.ReplaceAll(re.Error(), "\n", "\n\t"))
+	}
+	return sb.String()
+}
+
+func (e *RegistrationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, re := range e.Errors {
+		errs[i] = re
+	}
+	return errs
+}
+
+// errCollector gathers registration errors while Register runs.
+type errCollector struct {
+	errs   []*RouteError
+	closed bool
+}
+
+// Register calls fn to register routes on the Mux and returns all invalid
+// registrations as a *RegistrationError instead of panicking on the first
+// one. Routes of subrouters created with Route, Group, With and Host inside
+// fn are checked too. Invalid routes are skipped, valid ones are registered.
+func (mx *Mux) Register(fn func(r Router)) error {
+	c := &errCollector{}
+	prev := mx.errs
+	mx.errs = c
+	defer func() {
+		mx.errs = prev
+		c.closed = true
+	}()
+
+	fn(mx)
+
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return &RegistrationError{Errors: c.errs}
+}
+
+// TryHandle adds the route `pattern` like Handle, but returns an error
+// instead of panicking when the pattern is invalid or conflicts with
+// a registered route.
+func (mx *Mux) TryHandle(pattern string, handler http.Handler) error {
+	return mx.Register(func(r Router) {
+		r.Handle(pattern, handler)
+	})
+}
+
+// collector returns the error collector of the closest Mux running
+// Register along the parents of mx, or nil. It is resolved on every
+// failure, so subrouters created before Register report to it too.
+func (mx *Mux) collector() *errCollector {
+	for m := mx; m != nil; m = m.parent {
+		if m.errs != nil && !m.errs.closed {
+			return m.errs
+		}
+	}
+	return nil
+}
+
+// fail reports an invalid registration. It panics with the error message,
+// unless the errors are collected by Register.
+func (mx *Mux) fail(method, pattern string, err error) {
+	mx.report(&RouteError{Method: method, Pattern: pattern, Err: err})
+}
+
+func (mx *Mux) report(re *RouteError) {
+	c := mx.collector()
+	if c == nil {
+		panic(re.Error())
+	}
+	c.errs = append(c.errs, re)
+}
+
+var conflictRe = regexp.MustCompile(`conflicts with pattern ("(?:[^"\\]|\\.)*")`)
+
+// stdHandle registers a handler with http.ServeMux for the route `pattern`
+// converted to the http.ServeMux pattern `std`. Conflicts are reported
+// with fail.
+func (mx *Mux) stdHandle(method, pattern, std string, handler http.Handler) (ok bool) {
+	stdPattern := methodPattern(method, std)
+
+	defer func() {
+		if v := recover(); v != nil {
+			err, isErr := v.(error)
+			if !isErr {
+				err = fmt.Errorf("%v", v)
+			}
+			re := &RouteError{Method: method, Pattern: pattern, Err: err}
+			if rt := mx.conflicting(stdPattern); rt != nil {
+				re.Existing = methodPattern(rt.method, rt.pattern)
+				re.Err = constraintConflict(pattern, rt, err)
+			} else if m := conflictRe.FindStringSubmatch(err.Error()); m != nil {
+				re.Existing, _ = strconv.Unquote(m[1])
+			}
+			mx.report(re)
+			ok = false
+		}
+	}()
+	mx.stdmux.Handle(stdPattern, handler)
+	return true
+}
+
+// conflicting returns the registered route the http.ServeMux pattern
+// `std` conflicts with, or nil. Each route is registered with `std` on
+// a scratch http.ServeMux, as the panic message isn't a stable API.
+func (mx *Mux) conflicting(std string) *route {
+	if stdPanics(std) {
+		return nil
+	}
+	for _, rt := range mx.base().routes {
+		rtStd, _, _ := stdPattern(rt.pattern)
+		if stdPanics(methodPattern(rt.method, rtStd), std) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// methodPattern prefixes `pattern` with `method`, if any.
+func methodPattern(method, pattern string) string {
+	if method == "" {
+		return pattern
+	}
+	return method + " " + pattern
+}
+
+// stdPanics reports whether registering `patterns` with a http.ServeMux
+// panics.
+func stdPanics(patterns ...string) (panics bool) {
+	defer func() {
+		panics = recover() != nil
+	}()
+	mux := http.NewServeMux()
+	for _, p := range patterns {
+		mux.Handle(p, http.NotFoundHandler())
+	}
+	return false
+}
+
+// constraintConflict explains the conflict of `pattern` with the registered
+// route `rt` when one of them has regexp constraints: http.ServeMux doesn't
+// see the constraints, so routes like `/a/{id:int}` and `/a/{slug:alpha}`
+// can't be siblings.
+func constraintConflict(pattern string, rt *route, err error) error {
+	_, cons, _ := stdPattern(pattern)
+	_, rtCons, _ := stdPattern(rt.pattern)
+	if len(cons) == 0 && len(rtCons) == 0 {
+		return err
+	}
+	return fmt.Errorf("stdchi: routing pattern '%s' conflicts with '%s': wildcards of sibling routes can't differ by their constraints only", pattern, rt.pattern)
+}
@@ -0,0 +1,136 @@
+package stdchi
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HandlerFuncE is an http.Handler returning an error. The error is
+// written to the client by the error handler of the router the route
+// is registered on, see Router.ErrorHandler.
+//
+//	r.Handle("GET /users/{id}", stdchi.HandlerFuncE(getUser))
+//	r.Get("/users/{id}", stdchi.E(getUser))
+type HandlerFuncE func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP calls h(w, r) and handles the returned error with HandleError.
+func (h HandlerFuncE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h(w, r); err != nil {
+		HandleError(w, r, err)
+	}
+}
+
+// E adapts an error-returning handler for Get, Post and the other
+// method routes.
+func E(h func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return HandlerFuncE(h).ServeHTTP
+}
+
+// ErrorHandlerFunc writes the response for an error returned by a handler.
+type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+// HTTPError is an error with the HTTP status and the public message sent
+// to the client. The wrapped cause is kept for logging and errors.Is/As,
+// but never sent.
+type HTTPError struct {
+	// Status is the HTTP status code, 500 (Internal Server Error) when zero.
+	Status int
+
+	// Message is the public message, the status text when empty.
+	Message string
+
+	// Err is the underlying cause.
+	Err error
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.publicMessage()
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error { return e.Err }
+
+// StatusCode returns the HTTP status of the error.
+func (e *HTTPError) StatusCode() int {
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Status
+}
+
+func (e *HTTPError) publicMessage() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode())
+	}
+	return e.Message
+}
+
+// HandleError writes the response for `err` with the error handler of the
+// router that matched the request, or with DefaultErrorHandler. It can be
+// used by middlewares too, e.g. as the panic hook of a recoverer.
+func HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	if h := routeErrorHandler(r); h != nil {
+		h(w, r, err)
+		return
+	}
+	DefaultErrorHandler(w, r, err)
+}
+
+// routeErrorHandler returns the custom error handler of the router that
+// matched the request, or nil.
+func routeErrorHandler(r *http.Request) ErrorHandlerFunc {
+	if rc := routeCtxFromContext(r.Context()); rc != nil {
+		if _, _, mux := rc.state.get(); mux != nil {
+			return mux.customErrorHandler()
+		}
+	}
+	return nil
+}
+
+// DefaultErrorHandler responds with the problem details of `err`, see
+// ProblemFromError. The details of errors other than *HTTPError and
+// *Problem are hidden behind a 500 (Internal Server Error).
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	WriteProblem(w, r, ProblemFromError(err))
+}
+
+// ErrorStatus returns the HTTP status and the public message for `err`,
+// taken from the first *HTTPError or *Problem in its chain.
+func ErrorStatus(err error) (status int, message string) {
+	var pe publicError
+	if errors.As(err, &pe) {
+		return pe.StatusCode(), pe.publicMessage()
+	}
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+}
+
+// publicError is an error carrying the response status and message.
+type publicError interface {
+	error
+	StatusCode() int
+	publicMessage() string
+}
+
+// ErrorHandler sets the handler writing the responses for the errors
+// returned by HandlerFuncE routes. The default is DefaultErrorHandler.
+//
+// It applies to the routes registered on the router and is inherited by
+// the inline routers of With and Group and by subrouters attached with
+// Route or Mount that don't set their own.
+func (mx *Mux) ErrorHandler(h ErrorHandlerFunc) {
+	mx.errorHandler = h
+}
+
+// customErrorHandler returns the closest error handler set on the Mux
+// or on one of its parents, or nil.
+func (mx *Mux) customErrorHandler() ErrorHandlerFunc {
+	for m := mx; m != nil; m = m.parent {
+		if m.errorHandler != nil {
+			return m.errorHandler
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package stdchi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// hostRoute is a subrouter serving the requests for a host pattern
+// such as `api.example.com` or `{tenant}.example.com`.
+type hostRoute struct {
+	pattern string
+	labels  []string
+	mux     *Mux
+	cache   atomic.Pointer[compiledChain]
+}
+
+// Host creates a new Mux serving the requests whose host matches `pattern`
+// and calls fn to register its routes. Host labels may be wildcards, like
+// `{tenant}.example.com`, their values are provided as path values.
+//
+// Routes registered with a host prefix, e.g. `api.example.com/users/{id}`,
+// are added to the same subrouter. Requests for other hosts, and those
+// for the host no route of the subrouter matches, are routed by the Mux
+// as usual.
+func (mx *Mux) Host(pattern string, fn func(r Router)) Router {
+	if fn == nil {
+		mx.fail("", pattern, fmt.Errorf("stdchi: attempting to Host() a nil subrouter on '%s'", pattern))
+		return NewRouter()
+	}
+	hr := mx.hostRouter(pattern)
+	fn(hr)
+	return hr
+}
+
+// hostRouter returns the subrouter for host `pattern`, creating it on first
+// use. Inline middlewares, the route name and the metadata of mx are
+// carried over to it.
+// An invalid pattern gives a detached Mux while collecting errors with
+// Register.
+func (mx *Mux) hostRouter(pattern string) *Mux {
+	pattern = strings.ToLower(pattern)
+	base := mx.base()
+
+	var hr *hostRoute
+	for _, h := range base.hosts {
+		if h.pattern == pattern {
+			hr = h
+			break
+		}
+	}
+	if hr == nil {
+		labels := strings.Split(pattern, ".")
+		for _, l := range labels {
+			if l == "" || (strings.ContainsAny(l, "{}") && toWildcard(l) == "") {
+				mx.fail("", pattern, fmt.Errorf("stdchi: invalid host pattern '%s'", pattern))
+				detached := NewMux()
+				detached.errs = mx.collector()
+				return detached
+			}
+		}
+		hr = &hostRoute{pattern: pattern, labels: labels, mux: NewMux()}
+		hr.mux.parent = base
+
+		// Literal hosts are matched before hosts with wildcards.
+		i := len(base.hosts)
+		if !strings.Contains(pattern, "{") {
+			for i > 0 && strings.Contains(base.hosts[i-1].pattern, "{") {
+				i--
+			}
+		}
+		base.hosts = append(base.hosts, nil)
+		copy(base.hosts[i+1:], base.hosts[i:])
+		base.hosts[i] = hr
+	}
+
+	if mws := mx.inlineMiddlewares(); len(mws) > 0 || mx.name != "" || len(mx.meta) > 0 {
+		im := hr.mux.With(mws...).(*Mux)
+		im.name, im.meta = mx.name, mx.meta
+		return im
+	}
+	return hr.mux
+}
+
+// matchHost returns the host subrouter matching `host` and the values
+// of its wildcard labels.
+func (mx *Mux) matchHost(host string) (*hostRoute, map[string]string) {
+	host = stripHostPort(host)
+	labels := strings.Split(host, ".")
+	for _, hr := range mx.hosts {
+		if params, ok := hr.match(labels); ok {
+			return hr, params
+		}
+	}
+	return nil, nil
+}
+
+// routeHost returns the host subrouter serving `r` and the values of its
+// wildcard labels. Requests no route of the subrouter matches are served
+// by the routes of the Mux without a host, if one matches.
+func (mx *Mux) routeHost(r *http.Request) (*hostRoute, map[string]string) {
+	hr, params := mx.matchHost(r.Host)
+	if hr == nil {
+		return nil, nil
+	}
+	if _, pattern := hr.mux.stdmux.Handler(r); pattern == "" {
+		if _, pattern := mx.stdmux.Handler(r); pattern != "" {
+			return nil, nil
+		}
+	}
+	return hr, params
+}
+
+func (hr *hostRoute) match(labels []string) (map[string]string, bool) {
+	if len(labels) != len(hr.labels) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, l := range hr.labels {
+		if ws := toWildcard(l); ws != "" {
+			if labels[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[ws] = labels[i]
+		} else if !strings.EqualFold(l, labels[i]) {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// serveHost routes a request matching a host subrouter through the
+// middleware stack of the Mux.
+func (mx *Mux) serveHost(w http.ResponseWriter, r *http.Request, rc *routeCtx, hr *hostRoute, params map[string]string) {
+	rc.next = hr.mux
+	rc.pattern = joinPatterns(rc.prefix, hr.pattern+"/")
+	if len(params) > 0 {
+		values := make(wildcardValues, len(rc.values)+len(params))
+		for k, v := range rc.values {
+			values[k] = v
+		}
+		for k, v := range params {
+			values[k] = v
+			r.SetPathValue(k, v)
+		}
+		rc.values = values
+	}
+	rc.state.set(rc.pattern, rc.values, mx)
+	mx.compiledChain(&hr.cache, hr.mux).ServeHTTP(w, r)
+}
+
+// splitHostPattern splits a `host/path` pattern. As with http.ServeMux,
+// anything before the first slash is the host, e.g. `intranet/path`.
+func splitHostPattern(pattern string) (host, path string, ok bool) {
+	i := strings.IndexByte(pattern, '/')
+	if i <= 0 {
+		return "", "", false
+	}
+	return pattern[:i], pattern[i:], true
+}
+
+// stripHostPort returns h without any trailing ":<port>".
+func stripHostPort(h string) string {
+	i := strings.LastIndexByte(h, ':')
+	if i < 0 || strings.Contains(h[i:], "]") {
+		return h
+	}
+	return h[:i]
+}
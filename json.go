@@ -0,0 +1,289 @@
+package stdchi
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxJSONBodySize is the maximum size of the request bodies decoded by
+// JSON handlers, larger bodies are rejected with 413 (Request Entity Too Large).
+var MaxJSONBodySize int64 = 1 << 20
+
+// Validator is implemented by JSON handler requests validating themselves
+// after decoding and binding. Errors other than *HTTPError are sent with
+// status 422 (Unprocessable Entity).
+type Validator interface {
+	Validate() error
+}
+
+// JSON adapts a typed function to an http.HandlerFunc for Post, Put
+// and the other method routes.
+//
+// The request is decoded from the JSON body, rejecting unknown fields and
+// bodies larger than MaxJSONBodySize. Then struct fields tagged `path:"name"`
+// are set from the path values, including the ones of the mount points, and
+// fields tagged `query:"name"` from the query parameters. Fields of string,
+// bool, numeric, time.Duration and encoding.TextUnmarshaler types, pointers
+// to them and slices of them (for query parameters) are supported. Finally
+// the request is validated when it implements Validator.
+//
+// The response is encoded as JSON with status 200, or with the status
+// returned by its StatusCode() int method. Errors are written by the error
+// handler of the router, see Router.ErrorHandler, or as JSON problem
+// details by default.
+//
+//	type getUser struct {
+//		ID     int64 `path:"id"`
+//		Fields []string `query:"fields"`
+//	}
+//
+//	r.Get("/users/{id}", stdchi.JSON(func(ctx context.Context, req getUser) (*User, error) {
+//		...
+//	}))
+func JSON[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := decodeJSONRequest(w, r, &req); err != nil {
+			handleJSONError(w, r, err)
+			return
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			handleJSONError(w, r, err)
+			return
+		}
+
+		status := http.StatusOK
+		if sc, ok := any(resp).(interface{ StatusCode() int }); ok {
+			status = sc.StatusCode()
+		}
+		writeJSON(w, r, status, resp)
+	}
+}
+
+// decodeJSONRequest decodes, binds and validates a JSON handler request.
+func decodeJSONRequest(w http.ResponseWriter, r *http.Request, req any) error {
+	rv := reflect.ValueOf(req).Elem()
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		rv.Set(reflect.New(rv.Type().Elem()))
+	}
+	target := req
+	if rv.Kind() == reflect.Pointer {
+		target = rv.Interface()
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			mt, _, _ := mime.ParseMediaType(ct)
+			if mt != "application/json" && !strings.HasSuffix(mt, "+json") {
+				return &HTTPError{Status: http.StatusUnsupportedMediaType,
+					Message: fmt.Sprintf("unsupported content type %q", mt)}
+			}
+		}
+
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxJSONBodySize))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(target)
+		if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+			err = errors.New("body must contain a single JSON value")
+		}
+		if err != nil && err != io.EOF {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				return &HTTPError{Status: http.StatusRequestEntityTooLarge,
+					Message: fmt.Sprintf("request body larger than %d bytes", mbe.Limit), Err: err}
+			}
+			return &HTTPError{Status: http.StatusBadRequest, Message: "invalid request body: " + err.Error(), Err: err}
+		}
+	}
+
+	if sv := reflect.Indirect(reflect.ValueOf(target)); sv.Kind() == reflect.Struct {
+		if err := bindRequest(r, sv); err != nil {
+			return err
+		}
+	}
+
+	if v, ok := target.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			var he *HTTPError
+			if errors.As(err, &he) {
+				return err
+			}
+			return &HTTPError{Status: http.StatusUnprocessableEntity, Message: err.Error(), Err: err}
+		}
+	}
+	return nil
+}
+
+// bindField is a struct field bound to a path value or to a query parameter.
+type bindField struct {
+	index []int
+	name  string
+	query bool
+}
+
+var bindFields sync.Map // reflect.Type -> []bindField
+
+// fieldsToBind returns the fields of struct type `t` tagged with `path`
+// or `query`, including the promoted fields of embedded structs.
+func fieldsToBind(t reflect.Type) []bindField {
+	if fs, ok := bindFields.Load(t); ok {
+		return fs.([]bindField)
+	}
+	var fs []bindField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous || viaPointer(t, f.Index) {
+			continue
+		}
+		if name, ok := f.Tag.Lookup("path"); ok {
+			fs = append(fs, bindField{index: f.Index, name: name})
+		}
+		if name, ok := f.Tag.Lookup("query"); ok {
+			fs = append(fs, bindField{index: f.Index, name: name, query: true})
+		}
+	}
+	bindFields.Store(t, fs)
+	return fs
+}
+
+// viaPointer reports whether the field at `index` is promoted through
+// an embedded pointer, which may be nil.
+func viaPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Pointer {
+			return true
+		}
+	}
+	return false
+}
+
+func bindRequest(r *http.Request, sv reflect.Value) error {
+	var query map[string][]string
+	for _, f := range fieldsToBind(sv.Type()) {
+		var vals []string
+		if f.query {
+			if query == nil {
+				query = r.URL.Query()
+			}
+			vals = query[f.name]
+		} else if v := URLParam(r, f.name); v != "" {
+			vals = []string{v}
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		if err := setField(sv.FieldByIndex(f.index), vals); err != nil {
+			src := "path value"
+			if f.query {
+				src = "query parameter"
+			}
+			return &HTTPError{Status: http.StatusBadRequest,
+				Message: fmt.Sprintf("invalid %s %q: %v", src, f.name, err), Err: err}
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField sets field `v` from the string values of a path value or
+// a query parameter.
+func setField(v reflect.Value, vals []string) error {
+	if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(vals[0]))
+	}
+	s := vals[0]
+	switch v.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := setField(p.Elem(), vals); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Slice:
+		sl := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, s := range vals {
+			if err := setField(sl.Index(i), []string{s}); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// handleJSONError writes `err` with the error handler of the router,
+// or as a JSON problem details object by default.
+func handleJSONError(w http.ResponseWriter, r *http.Request, err error) {
+	if h := routeErrorHandler(r); h != nil {
+		h(w, r, err)
+		return
+	}
+	p := ProblemFromError(err)
+	writeProblem(w, r, p, p.publicMessage(), true)
+}
+
+// writeJSON writes `v` encoded as JSON with `status`.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		DefaultErrorHandler(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(b, '\n'))
+}
@@ -1,57 +1,88 @@
 package stdchi
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
+	"sort"
 	"strings"
+	"sync"
 )
 
-type methodTyp uint
-
-const (
-	mSTUB methodTyp = 1 << iota
-	mCONNECT
-	mDELETE
-	mGET
-	mHEAD
-	mOPTIONS
-	mPATCH
-	mPOST
-	mPUT
-	mTRACE
+var (
+	methodsMu sync.RWMutex
+	methodMap = map[string]struct{}{
+		http.MethodConnect: {},
+		http.MethodDelete:  {},
+		http.MethodGet:     {},
+		http.MethodHead:    {},
+		http.MethodOptions: {},
+		http.MethodPatch:   {},
+		http.MethodPost:    {},
+		http.MethodPut:     {},
+		http.MethodTrace:   {},
+	}
 )
 
-var mALL = mCONNECT | mDELETE | mGET | mHEAD |
-	mOPTIONS | mPATCH | mPOST | mPUT | mTRACE
-
-var methodMap = map[string]methodTyp{
-	http.MethodConnect: mCONNECT,
-	http.MethodDelete:  mDELETE,
-	http.MethodGet:     mGET,
-	http.MethodHead:    mHEAD,
-	http.MethodOptions: mOPTIONS,
-	http.MethodPatch:   mPATCH,
-	http.MethodPost:    mPOST,
-	http.MethodPut:     mPUT,
-	http.MethodTrace:   mTRACE,
-}
-
 // RegisterMethod adds support for custom HTTP method handlers, available
-// via Router#Method and Router#MethodFunc
+// via Router#Method and Router#MethodFunc on every router. Use
+// Mux#RegisterMethod to register a method on a single router.
 func RegisterMethod(method string) {
 	if method == "" {
 		return
 	}
 	method = strings.ToUpper(method)
-	if _, ok := methodMap[method]; ok {
-		return
+	methodsMu.Lock()
+	methodMap[method] = struct{}{}
+	methodsMu.Unlock()
+}
+
+// RegisterMethod adds support for custom HTTP method handlers on the Mux
+// and its subrouters, available via Router#Method and Router#MethodFunc,
+// e.g. WebDAV methods like PROPFIND and MKCOL on a single subrouter.
+func (mx *Mux) RegisterMethod(methods ...string) {
+	base := mx.base()
+	base.methodsMu.Lock()
+	defer base.methodsMu.Unlock()
+	for _, m := range methods {
+		if m == "" {
+			continue
+		}
+		if base.methods == nil {
+			base.methods = map[string]struct{}{}
+		}
+		base.methods[strings.ToUpper(m)] = struct{}{}
+	}
+}
+
+// supportsMethod reports whether `method` is registered globally or
+// on the Mux or any of its parents.
+func (mx *Mux) supportsMethod(method string) bool {
+	methodsMu.RLock()
+	_, ok := methodMap[method]
+	methodsMu.RUnlock()
+	for m := mx; !ok && m != nil; m = m.parent {
+		if m.inline {
+			continue
+		}
+		m.methodsMu.RLock()
+		_, ok = m.methods[method]
+		m.methodsMu.RUnlock()
+	}
+	return ok
+}
+
+// addMethod adds a method to a comma separated Allow header value,
+// keeping it sorted.
+func addMethod(allow, method string) string {
+	methods := strings.Split(allow, ", ")
+	if allow == "" {
+		methods = nil
 	}
-	n := len(methodMap)
-	if n > strconv.IntSize-2 {
-		panic(fmt.Sprintf("chi: max number of methods reached (%d)", strconv.IntSize))
+	for _, m := range methods {
+		if m == method {
+			return allow
+		}
 	}
-	mt := methodTyp(2 << n)
-	methodMap[method] = mt
-	mALL |= mt
+	methods = append(methods, method)
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
 }
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// CleanPath middleware will clean out double slash mistakes from a user's request path.
+// For example, if a user requests /users//1 or //users////1 will both be treated as: /users/1
+//
+// It rewrites r.URL, so it must wrap the router to change the routing.
+func CleanPath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if p == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cleaned := path.Clean(p)
+		if p[len(p)-1] == '/' && cleaned != "/" {
+			cleaned += "/"
+		}
+		if cleaned != p {
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = cleaned
+			if r.URL.RawPath != "" {
+				r2.URL.RawPath = path.Clean(r.URL.RawPath)
+				if p[len(p)-1] == '/' && r2.URL.RawPath != "/" {
+					r2.URL.RawPath += "/"
+				}
+			}
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
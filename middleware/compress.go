@@ -0,0 +1,549 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var defaultCompressibleContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"application/javascript",
+	"application/x-javascript",
+	"application/json",
+	"application/problem+json",
+	"application/atom+xml",
+	"application/rss+xml",
+	"image/svg+xml",
+}
+
+// DefaultCompressMinSize is the default size in bytes a response body must
+// reach to be compressed. Smaller bodies are sent as is, since the encoding
+// overhead outweighs the savings.
+const DefaultCompressMinSize = 1024
+
+// Compress is a middleware that compresses response body of a given content
+// types to a data format based on Accept-Encoding request header. It uses a
+// given compression level.
+//
+// NOTE: make sure to set the Content-Type header on your response otherwise
+// it is sniffed from the first bytes of the body like http.ResponseWriter
+// does. Passing a compression level of 5 is sensible value.
+func Compress(level int, types ...string) func(next http.Handler) http.Handler {
+	compressor := NewCompressor(level, types...)
+	return compressor.Handler
+}
+
+// Compressor represents a set of encoding configurations.
+type Compressor struct {
+	// The mapping of encoder names to encoder functions.
+	encoders map[string]EncoderFunc
+	// The mapping of pooled encoders to pools.
+	pooledEncoders map[string]*sync.Pool
+	// The set of content types allowed to be compressed.
+	allowedTypes     map[string]struct{}
+	allowedWildcards map[string]struct{}
+	// The list of encoders in order of decreasing precedence.
+	encodingPrecedence []string
+	level              int // The compression level.
+	minSize            int // The minimum body size to compress.
+}
+
+// NewCompressor creates a new Compressor that will handle encoding responses.
+//
+// The level should be one of the ones defined in the flate package.
+// The types are the content types that are allowed to be compressed,
+// a `type/*` entry allows every subtype of the type.
+func NewCompressor(level int, types ...string) *Compressor {
+	// If types are provided, set those as the allowed types. If none are
+	// provided, use the default list.
+	allowedTypes := make(map[string]struct{})
+	allowedWildcards := make(map[string]struct{})
+	if len(types) == 0 {
+		types = defaultCompressibleContentTypes
+	}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if strings.Contains(strings.TrimSuffix(t, "/*"), "*") {
+			panic(fmt.Sprintf("stdchi/middleware: Compress content type '%s' has an unsupported wildcard", t))
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			allowedWildcards[prefix] = struct{}{}
+		} else {
+			allowedTypes[t] = struct{}{}
+		}
+	}
+
+	c := &Compressor{
+		level:            level,
+		minSize:          DefaultCompressMinSize,
+		encoders:         make(map[string]EncoderFunc),
+		pooledEncoders:   make(map[string]*sync.Pool),
+		allowedTypes:     allowedTypes,
+		allowedWildcards: allowedWildcards,
+	}
+
+	// Set the default encoders. The precedence order uses the reverse
+	// ordering that the encoders were added. This means adding new encoders
+	// will move them to the front of the order. Other encodings like br or
+	// zstd are added with SetEncoder.
+
+	// HTTP 1.1 "deflate" (RFC 2616) stands for DEFLATE data (RFC 1951)
+	// wrapped with zlib (RFC 1950). The zlib wrapper uses Adler-32
+	// checksum compared to CRC-32 used in "gzip" and thus is faster.
+	//
+	// But.. some old browsers (MSIE, Safari 5.1) incorrectly expect
+	// raw DEFLATE data only, without the mentioned zlib wrapper.
+	// Because of this major confusion, most modern browsers try it
+	// both ways, first looking for zlib headers.
+	// Quote by Mark Adler: http://stackoverflow.com/a/9186091/385548
+	//
+	// The list of browsers having problems is quite big, see:
+	// http://zoompf.com/blog/2012/02/lose-the-wait-http-compression
+	// https://web.archive.org/web/20120321182910/http://www.vervestudios.co/projects/compression-tests/results
+	//
+	// That's why we prefer gzip over deflate. It's just more reliable
+	// and not significantly slower than deflate.
+	c.SetEncoder("deflate", encoderDeflate)
+
+	// TODO: Exception for old MSIE browsers that can't handle non-HTML?
+	// https://zoompf.com/blog/2012/02/lose-the-wait-http-compression
+	c.SetEncoder("gzip", encoderGzip)
+
+	// NOTE: Not implemented, intentionally:
+	// case "compress": // LZW. Deprecated.
+	// case "bzip2":    // Too slow on-the-fly.
+	// case "zopfli":   // Too slow on-the-fly.
+	// case "xz":       // Too slow on-the-fly.
+	return c
+}
+
+// SetEncoder can be used to set the implementation of a compression algorithm.
+//
+// The encoding should be a standardised identifier. See:
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Accept-Encoding
+//
+// For example, add the Brotli algorithm:
+//
+//	import brotli_enc "gopkg.in/kothar/brotli-go.v0/enc"
+//
+//	compressor := middleware.NewCompressor(5, "text/html")
+//	compressor.SetEncoder("br", func(w io.Writer, level int) io.Writer {
+//		params := brotli_enc.NewBrotliParams()
+//		params.SetQuality(level)
+//		return brotli_enc.NewBrotliWriter(params, w)
+//	})
+//
+// Encoders returning a writer with a `Reset(io.Writer)` method are pooled.
+// The writer is flushed with its `Flush() error` method and finished with
+// its `Close() error` method when it has them.
+func (c *Compressor) SetEncoder(encoding string, fn EncoderFunc) {
+	encoding = strings.ToLower(encoding)
+	if encoding == "" {
+		panic("stdchi/middleware: the encoding can not be empty")
+	}
+	if fn == nil {
+		panic("stdchi/middleware: attempted to set a nil encoder function")
+	}
+
+	// If we are adding a new encoder that is already registered, we have to
+	// clear that one out first.
+	delete(c.pooledEncoders, encoding)
+	delete(c.encoders, encoding)
+
+	// If the encoder supports Resetting (IoReseterWriter), then it can be pooled.
+	encoder := fn(io.Discard, c.level)
+	if _, ok := encoder.(ioResetterWriter); ok {
+		pool := &sync.Pool{
+			New: func() interface{} {
+				return fn(io.Discard, c.level)
+			},
+		}
+		c.pooledEncoders[encoding] = pool
+	}
+	// If the encoder is not in the pooledEncoders, add it to the normal encoders.
+	if _, ok := c.pooledEncoders[encoding]; !ok {
+		c.encoders[encoding] = fn
+	}
+
+	for i, v := range c.encodingPrecedence {
+		if v == encoding {
+			c.encodingPrecedence = append(c.encodingPrecedence[:i], c.encodingPrecedence[i+1:]...)
+		}
+	}
+
+	c.encodingPrecedence = append([]string{encoding}, c.encodingPrecedence...)
+}
+
+// SetMinSize sets the size in bytes a response body must reach to be
+// compressed, DefaultCompressMinSize by default. Bodies are buffered until
+// they reach the size, the response is finished or flushed.
+func (c *Compressor) SetMinSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	c.minSize = n
+}
+
+// Handler returns a new middleware that will compress the response based on the
+// current Compressor.
+func (c *Compressor) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Partial content is computed over the identity encoding.
+		if r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			c:              c,
+			encoding:       c.selectEncoding(r.Header),
+		}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// selectEncoding returns the name of the registered encoder preferred by the
+// Accept-Encoding header, or an empty string when none is acceptable.
+// Among equal q-values the encoder precedence decides.
+func (c *Compressor) selectEncoding(h http.Header) string {
+	accepted := parseAcceptEncoding(h.Values("Accept-Encoding"))
+	if len(accepted) == 0 {
+		return ""
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, name := range c.encodingPrecedence {
+		q, ok := accepted[name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// parseAcceptEncoding returns the q-values of the Accept-Encoding codings.
+func parseAcceptEncoding(values []string) map[string]float64 {
+	var accepted map[string]float64
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			for _, p := range strings.Split(params, ";") {
+				k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if strings.EqualFold(k, "q") {
+					f, err := strconv.ParseFloat(v, 64)
+					if err != nil || f < 0 {
+						f = 0
+					}
+					q = min(f, 1)
+				}
+			}
+			if accepted == nil {
+				accepted = map[string]float64{}
+			}
+			accepted[name] = q
+		}
+	}
+	return accepted
+}
+
+// getEncoder returns a writer of the encoding writing to w, and a function
+// returning it to the pool.
+func (c *Compressor) getEncoder(encoding string, w io.Writer) (io.Writer, func()) {
+	if pool, ok := c.pooledEncoders[encoding]; ok {
+		encoder := pool.Get().(ioResetterWriter)
+		encoder.Reset(w)
+		return encoder, func() { pool.Put(encoder) }
+	}
+	if fn, ok := c.encoders[encoding]; ok {
+		return fn(w, c.level), func() {}
+	}
+	return nil, func() {}
+}
+
+// isCompressible reports whether the content type is allowed to be compressed.
+func (c *Compressor) isCompressible(contentType string) bool {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if _, ok := c.allowedTypes[contentType]; ok {
+		return true
+	}
+	if mainType, _, ok := strings.Cut(contentType, "/"); ok {
+		_, ok = c.allowedWildcards[mainType]
+		return ok
+	}
+	return false
+}
+
+// An EncoderFunc is a function that wraps the provided io.Writer with a
+// streaming compression algorithm and returns it.
+//
+// In case of failure, the function should return nil.
+type EncoderFunc func(w io.Writer, level int) io.Writer
+
+// Interface for types that allow resetting io.Writers.
+type ioResetterWriter interface {
+	io.Writer
+	Reset(w io.Writer)
+}
+
+type compressFlusher interface {
+	Flush() error
+}
+
+// compressResponseWriter buffers the beginning of the body until it knows
+// whether the response is compressed, then writes through the encoder or
+// straight to the wrapped writer.
+type compressResponseWriter struct {
+	http.ResponseWriter
+
+	c        *Compressor
+	encoding string // The negotiated encoding, empty for none.
+
+	status      int
+	wroteHeader bool   // WriteHeader was called by the handler.
+	decided     bool   // The headers are sent to the wrapped writer.
+	hijacked    bool   // The connection was hijacked.
+	buf         []byte // The body written before deciding.
+
+	encoder io.Writer // The encoder when the response is compressed.
+	release func()
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader || cw.decided {
+		return
+	}
+	// Informational responses are sent right away.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	cw.wroteHeader = true
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.c.minSize && cw.mayCompress() {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// mayCompress reports whether the response may still be compressed once
+// the body is big enough.
+func (cw *compressResponseWriter) mayCompress() bool {
+	if cw.encoding == "" {
+		return false
+	}
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < cw.c.minSize {
+			return false
+		}
+	}
+	switch cw.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	if ct := h.Get("Content-Type"); ct != "" {
+		return cw.c.isCompressible(ct)
+	}
+	return true
+}
+
+// decide sends the headers and the buffered body, through the encoder when
+// the response is compressed. Bodies smaller than the minimum size are only
+// compressed when `force` is set, on flushes.
+func (cw *compressResponseWriter) decide(force bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	// Sniff the content type like http.ResponseWriter does, since the
+	// wrapped writer sees the compressed body.
+	if _, hasType := h["Content-Type"]; !hasType && h.Get("Content-Encoding") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if ct := h.Get("Content-Type"); ct != "" && cw.c.isCompressible(ct) && h.Get("Content-Encoding") == "" {
+		addVary(h, "Accept-Encoding")
+	}
+
+	if (force || len(cw.buf) >= cw.c.minSize) && cw.mayCompress() {
+		encoder, release := cw.c.getEncoder(cw.encoding, cw.ResponseWriter)
+		if encoder != nil {
+			cw.encoder, cw.release = encoder, release
+			h.Set("Content-Encoding", cw.encoding)
+			h.Del("Content-Length")
+			h.Del("Accept-Ranges")
+			// A strong validator identifies the identity encoding.
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+
+	status := cw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// addVary adds a value to the Vary header unless it is listed already.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "*" || strings.EqualFold(s, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided && !cw.hijacked {
+		cw.decide(len(cw.buf) > 0)
+	}
+	if f, ok := cw.encoder.(compressFlusher); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressResponseWriter) FlushError() error {
+	if !cw.decided && !cw.hijacked {
+		if err := cw.decide(len(cw.buf) > 0); err != nil {
+			return err
+		}
+	}
+	if f, ok := cw.encoder.(compressFlusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		conn, rw, err := hj.Hijack()
+		if err == nil {
+			cw.hijacked = true
+		}
+		return conn, rw, err
+	}
+	return nil, nil, fmt.Errorf("stdchi/middleware: http.Hijacker is unavailable on the writer: %w", http.ErrNotSupported)
+}
+
+func (cw *compressResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if ps, ok := cw.ResponseWriter.(http.Pusher); ok {
+		return ps.Push(target, opts)
+	}
+	return fmt.Errorf("stdchi/middleware: http.Pusher is unavailable on the writer: %w", http.ErrNotSupported)
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close sends a body left in the buffer and finishes the encoder.
+func (cw *compressResponseWriter) Close() error {
+	if cw.hijacked {
+		return nil
+	}
+	if !cw.decided {
+		if !cw.wroteHeader && len(cw.buf) == 0 {
+			// Nothing was written, let the server send its default response.
+			cw.decided = true
+			return nil
+		}
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.encoder == nil {
+		return nil
+	}
+	var err error
+	if c, ok := cw.encoder.(io.Closer); ok {
+		err = c.Close()
+	}
+	cw.release()
+	cw.encoder = nil
+	return err
+}
+
+func encoderGzip(w io.Writer, level int) io.Writer {
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil
+	}
+	return gw
+}
+
+func encoderDeflate(w io.Writer, level int) io.Writer {
+	dw, err := zlib.NewWriterLevel(w, level)
+	if err != nil {
+		return nil
+	}
+	return dw
+}
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CORSOpts configures the CORS middleware.
+type CORSOpts struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin
+	// requests. An origin may contain one `*` wildcard, e.g.
+	// `https://*.example.com`, and "*" allows all origins.
+	AllowedOrigins []string
+
+	// AllowedOriginRegexps lists regular expressions matching the allowed
+	// origins. They are matched against the whole origin.
+	AllowedOriginRegexps []string
+
+	// AllowOriginFunc, when set, decides whether the origins that are not
+	// allowed by AllowedOrigins and AllowedOriginRegexps are allowed.
+	AllowOriginFunc func(r *http.Request, origin string) bool
+
+	// AllowedMethods lists the methods allowed for cross-origin requests.
+	// When empty, they are the methods registered on the router for the
+	// requested path: CORS asks the wrapped handler, or Router when set,
+	// for its AllowedMethods, like *stdchi.Mux does. Used with Mux.Use
+	// next to AutoOptions, the Allow header of the OPTIONS response is used.
+	// GET, POST and HEAD are allowed otherwise.
+	AllowedMethods []string
+
+	// Router gives the methods registered for the requested path when
+	// AllowedMethods is empty.
+	Router MethodsRouter
+
+	// AllowedHeaders lists the non-simple headers clients may send.
+	// "*" allows all headers. The default is Accept, Content-Type and
+	// X-Requested-With.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the headers clients may read in the responses.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests with cookies and HTTP authentication.
+	AllowCredentials bool
+
+	// MaxAge is how long, in seconds, the preflight responses may be cached.
+	MaxAge int
+
+	// OptionsPassthrough passes the preflight requests to the next handler
+	// after setting the CORS headers.
+	OptionsPassthrough bool
+
+	// OptionsSuccessStatus is the status of the preflight responses,
+	// 204 (No Content) when zero.
+	OptionsSuccessStatus int
+}
+
+// MethodsRouter lists the methods registered for the requested path,
+// like *stdchi.Mux.
+type MethodsRouter interface {
+	AllowedMethods(r *http.Request) []string
+}
+
+// CORS is a middleware handling Cross-Origin Resource Sharing: it answers
+// the preflight requests and sets the CORS headers of the actual requests
+// from the allowed origins.
+//
+// stdchi runs the middleware stack of a Mux after matching a route, so
+// preflight requests to paths without an OPTIONS route reach the middleware
+// only when it wraps the router, or when AutoOptions is enabled:
+//
+//	http.ListenAndServe(":3333", middleware.CORS(middleware.CORSOpts{
+//		AllowedOrigins: []string{"https://*.example.com"},
+//	})(r))
+func CORS(opts CORSOpts) func(http.Handler) http.Handler {
+	c := &cors{opts: opts, allowedHeaders: map[string]bool{}}
+	for _, o := range opts.AllowedOrigins {
+		o = strings.ToLower(o)
+		switch {
+		case o == "*":
+			c.allowAll = true
+		case strings.Contains(o, "*"):
+			prefix, suffix, _ := strings.Cut(o, "*")
+			c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+		default:
+			c.origins = append(c.origins, o)
+		}
+	}
+	for _, expr := range opts.AllowedOriginRegexps {
+		c.regexps = append(c.regexps, regexp.MustCompile("^(?:"+expr+")$"))
+	}
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Accept", "Content-Type", "X-Requested-With"}
+	}
+	for _, h := range headers {
+		if h == "*" {
+			c.allowAllHeaders = true
+		}
+		c.allowedHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	if c.opts.OptionsSuccessStatus == 0 {
+		c.opts.OptionsSuccessStatus = http.StatusNoContent
+	}
+
+	return func(next http.Handler) http.Handler {
+		router := opts.Router
+		if router == nil {
+			router, _ = next.(MethodsRouter)
+		}
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, r, router)
+				if opts.OptionsPassthrough {
+					next.ServeHTTP(w, r)
+				} else {
+					w.WriteHeader(c.opts.OptionsSuccessStatus)
+				}
+				return
+			}
+			c.actual(w, r)
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+type cors struct {
+	opts            CORSOpts
+	allowAll        bool
+	origins         []string
+	wildcards       [][2]string
+	regexps         []*regexp.Regexp
+	allowAllHeaders bool
+	allowedHeaders  map[string]bool
+}
+
+func (c *cors) originAllowed(r *http.Request, origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	o := strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		if o == allowed {
+			return true
+		}
+	}
+	for _, w := range c.wildcards {
+		if len(o) >= len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+	for _, re := range c.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return c.opts.AllowOriginFunc != nil && c.opts.AllowOriginFunc(r, origin)
+}
+
+// allowedMethods returns the methods allowed for the requested path.
+func (c *cors) allowedMethods(w http.ResponseWriter, r *http.Request, router MethodsRouter) []string {
+	if len(c.opts.AllowedMethods) > 0 {
+		return c.opts.AllowedMethods
+	}
+	if router != nil {
+		return router.AllowedMethods(r)
+	}
+	if allow := w.Header().Get("Allow"); allow != "" {
+		return strings.Split(allow, ", ")
+	}
+	return []string{http.MethodGet, http.MethodPost, http.MethodHead}
+}
+
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request, router MethodsRouter) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.originAllowed(r, origin) {
+		return
+	}
+
+	reqMethod := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	methods := c.allowedMethods(w, r, router)
+	allowed := false
+	for _, m := range methods {
+		if m == "*" || strings.EqualFold(m, reqMethod) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return
+	}
+
+	var reqHeaders []string
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, rh := range strings.Split(v, ",") {
+			if rh = strings.TrimSpace(rh); rh == "" {
+				continue
+			}
+			if !c.allowAllHeaders && !c.allowedHeaders[http.CanonicalHeaderKey(rh)] {
+				return
+			}
+			reqHeaders = append(reqHeaders, rh)
+		}
+	}
+
+	c.setOrigin(h, origin)
+	if len(methods) == 1 && methods[0] == "*" {
+		methods = []string{reqMethod}
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(reqHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if c.opts.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(c.opts.MaxAge))
+	}
+}
+
+func (c *cors) actual(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.originAllowed(r, origin) {
+		return
+	}
+	c.setOrigin(h, origin)
+	if len(c.opts.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ", "))
+	}
+}
+
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.allowAll && !c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
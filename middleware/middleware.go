@@ -0,0 +1,33 @@
+// Package middleware provides the chi standard middlewares for stdchi
+// routers. They depend on net/http only and can be used with any
+// http.Handler.
+//
+// stdchi runs the middleware stack of a Mux after http.ServeMux has
+// matched the route, so the middlewares rewriting the request path
+// (StripSlashes, RedirectSlashes and CleanPath) must wrap the router
+// itself to change the routing:
+//
+//	http.ListenAndServe(":3333", middleware.StripSlashes(r))
+package middleware
+
+import "net/http"
+
+// New will create a new middleware handler from a http.Handler.
+func New(h http.Handler) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// contextKey is a value for use with context.WithValue. It's used as
+// a pointer so it fits in an interface{} without allocation. This technique
+// for defining context keys was copied from Go 1.7's new use of context in net/http.
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string {
+	return "stdchi/middleware context value " + k.name
+}
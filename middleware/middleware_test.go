@@ -0,0 +1,760 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/covrom/stdchi"
+)
+
+func testRequest(t *testing.T, h http.Handler, method, path string, body io.Reader, header http.Header) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w, w.Body.String()
+}
+
+func TestRequestID(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Use(RequestID)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetReqID(r.Context())))
+	})
+
+	if _, body := testRequest(t, r, "GET", "/", nil, nil); !strings.HasPrefix(body, prefix+"-") {
+		t.Fatalf(body)
+	}
+	hdr := http.Header{RequestIDHeader: {"req-1"}}
+	if _, body := testRequest(t, r, "GET", "/", nil, hdr); body != "req-1" {
+		t.Fatalf(body)
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Use(RealIP)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	})
+
+	tests := []struct {
+		header http.Header
+		want   string
+	}{
+		{http.Header{"X-Real-Ip": {"100.100.100.100"}}, "100.100.100.100"},
+		{http.Header{"True-Client-Ip": {"2001:db8::1"}, "X-Real-Ip": {"100.100.100.100"}}, "2001:db8::1"},
+		{http.Header{"X-Forwarded-For": {"100.100.100.100, 10.0.0.1"}}, "100.100.100.100"},
+		{http.Header{"X-Real-Ip": {"not-an-ip"}}, "192.0.2.1:1234"},
+	}
+	for _, tt := range tests {
+		if _, body := testRequest(t, r, "GET", "/", nil, tt.header); body != tt.want {
+			t.Fatalf("%v: %s", tt.header, body)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := RequestLogger(&DefaultLogFormatter{Logger: log.New(&buf, "", 0), NoColor: true})
+
+	r := stdchi.NewRouter()
+	r.Use(RequestID, logger)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	testRequest(t, r, "GET", "/1", nil, http.Header{RequestIDHeader: {"req-1"}})
+	if out := buf.String(); !strings.HasPrefix(out, `[req-1] "GET http://example.com/1 HTTP/1.1" from 192.0.2.1:1234 - 201 5B in `) {
+		t.Fatalf(out)
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := SlogLoggerWithOpts(SlogOpts{
+		Logger:       slog.New(slog.NewJSONHandler(&buf, nil)),
+		StatusLevels: map[int]slog.Level{4: slog.LevelInfo},
+		Redact:       []string{"Token"},
+	})
+
+	api := stdchi.NewRouter()
+	api.Get("/keys/{token}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("expecting http.Flusher")
+		}
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hello"))
+	})
+
+	r := stdchi.NewRouter()
+	r.Use(RequestID, logger)
+	r.Mount("/{tenant}", api)
+
+	testRequest(t, r, "GET", "/acme/keys/secret", nil, http.Header{RequestIDHeader: {"req-1"}})
+
+	var rec struct {
+		Level      string            `json:"level"`
+		Msg        string            `json:"msg"`
+		Method     string            `json:"method"`
+		Path       string            `json:"path"`
+		Pattern    string            `json:"pattern"`
+		PathValues map[string]string `json:"path_values"`
+		Status     int               `json:"status"`
+		Bytes      int               `json:"bytes"`
+		RequestID  string            `json:"request_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	if rec.Level != "INFO" || rec.Msg != "request" || rec.Method != "GET" || rec.Path != "/acme/keys/secret" ||
+		rec.Pattern != "/{tenant}/keys/{token}" || rec.Status != http.StatusTeapot || rec.Bytes != 5 || rec.RequestID != "req-1" {
+		t.Fatalf(buf.String())
+	}
+	if rec.PathValues["tenant"] != "acme" || rec.PathValues["token"] != "[REDACTED]" {
+		t.Fatalf(buf.String())
+	}
+}
+
+func TestRecoverer(t *testing.T) {
+	var buf bytes.Buffer
+	prev := recovererErrorWriter
+	recovererErrorWriter = &buf
+	defer func() { recovererErrorWriter = prev }()
+
+	r := stdchi.NewRouter()
+	r.Use(Recoverer)
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("foo")
+	})
+	r.Get("/abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	if w, _ := testRequest(t, r, "GET", "/panic", nil, nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if !strings.Contains(buf.String(), "panic: foo [/panic]") {
+		t.Fatalf(buf.String())
+	}
+
+	defer func() {
+		if rvr := recover(); rvr != http.ErrAbortHandler {
+			t.Fatalf("expecting http.ErrAbortHandler to be re-panicked, got %v", rvr)
+		}
+	}()
+	testRequest(t, r, "GET", "/abort", nil, nil)
+}
+
+func TestRecovererWithOpts(t *testing.T) {
+	var logs bytes.Buffer
+	var perr *PanicError
+
+	r := stdchi.NewRouter()
+	r.Use(RecovererWithOpts(RecovererOpts{
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+		Render: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "oops", http.StatusInternalServerError)
+		}),
+	}))
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("foo")
+	})
+	r.With(RecovererWithOpts(RecovererOpts{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			errors.As(err, &perr)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	})).Get("/err", func(w http.ResponseWriter, r *http.Request) {
+		panic(io.ErrUnexpectedEOF)
+	})
+
+	if w, body := testRequest(t, r, "GET", "/users/1", nil, nil); w.Code != http.StatusInternalServerError || body != "oops\n" {
+		t.Fatalf(body)
+	}
+	if out := logs.String(); !strings.Contains(out, "panic=foo") || !strings.Contains(out, "pattern=/users/{id}") || !strings.Contains(out, "stack=") {
+		t.Fatalf(out)
+	}
+
+	if w, _ := testRequest(t, r, "GET", "/err", nil, nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if perr == nil || perr.Pattern != "/err" || !errors.Is(perr, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error %v", perr)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Outer", "1")
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Group(func(r stdchi.Router) {
+		r.Use(Timeout(10 * time.Millisecond))
+		r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+		r.Get("/late", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Inner", "1")
+			<-r.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			if _, err := w.Write([]byte("late")); !errors.Is(err, http.ErrHandlerTimeout) {
+				t.Errorf("expecting a timeout error, got %v", err)
+			}
+		})
+		r.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("a"))
+			http.NewResponseController(w).Flush()
+			<-r.Context().Done()
+			w.Write([]byte("b"))
+		})
+	})
+	r.With(Timeout(time.Second)).Get("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Inner", "1")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+		inner  string
+	}{
+		{"/slow", http.StatusGatewayTimeout, "Gateway Timeout\n", ""},
+		{"/late", http.StatusGatewayTimeout, "Gateway Timeout\n", ""},
+		{"/stream", http.StatusOK, "ab", ""},
+		{"/fast", http.StatusOK, "", "1"},
+	}
+	for _, tt := range tests {
+		w, body := testRequest(t, r, "GET", tt.path, nil, nil)
+		if w.Code != tt.status || body != tt.body {
+			t.Fatalf("%s: unexpected response %d %q", tt.path, w.Code, body)
+		}
+		if w.Header().Get("X-Outer") != "1" || w.Header().Get("X-Inner") != tt.inner {
+			t.Fatalf("%s: unexpected headers %v", tt.path, w.Header())
+		}
+	}
+
+	// The timeout response is complete at the deadline, even when
+	// the handler ignores the context.
+	r.With(Timeout(30*time.Millisecond)).Get("/ignore", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	start := time.Now()
+	resp, err := http.Get(ts.URL + "/ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusGatewayTimeout || string(b) != "Gateway Timeout\n" {
+		t.Fatalf("unexpected response %d %q %v", resp.StatusCode, b, err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Fatalf("timeout response completed after %v", d)
+	}
+
+	// The timeout response is written while subrouters may still be
+	// routing the request, run with -race.
+	rr := stdchi.NewRouter()
+	rr.ErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		status, _ := stdchi.ErrorStatus(err)
+		w.WriteHeader(status)
+		for k, v := range stdchi.PathValues(r) {
+			w.Write([]byte(k + "=" + v + " " + stdchi.RoutePattern(r.Context())))
+		}
+	})
+	rr.Use(Timeout(time.Millisecond))
+	rr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond)
+			next.ServeHTTP(w, r)
+		})
+	})
+	rr.Route("/{tenant}", func(r stdchi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+	})
+	for i := 0; i < 50; i++ {
+		if w, _ := testRequest(t, rr, "GET", "/acme/1", nil, nil); w.Code != http.StatusGatewayTimeout {
+			t.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	throttler := NewThrottler(ThrottleOpts{Limit: 1, BacklogLimit: 1, BacklogTimeout: 20 * time.Millisecond})
+
+	r := stdchi.NewRouter()
+	r.ErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		var he *stdchi.HTTPError
+		if errors.As(err, &he) {
+			w.WriteHeader(he.Status)
+			w.Write([]byte(he.Message))
+		}
+	})
+	r.Use(throttler.Handler)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	r.Get("/other", func(w http.ResponseWriter, r *http.Request) {})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		testRequest(t, r, "GET", "/", nil, nil)
+	}()
+	<-started
+
+	if st := throttler.Stats(); st.InFlight != 1 || st.Waiting != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// the backlogged request times out waiting for the first one, the limit
+	// is shared by the routes of the router
+	w, body := testRequest(t, r, "GET", "/other", nil, nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" || body != errTimedOut {
+		t.Fatalf("unexpected response %d %v %q", w.Code, w.Header(), body)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if w, _ := testRequest(t, r, "GET", "/other", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if st := throttler.Stats(); st != (ThrottleStats{Served: 2, Rejected: 1}) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestNoCache(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Use(NoCache)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("If-None-Match")))
+	})
+
+	w, body := testRequest(t, r, "GET", "/", nil, http.Header{"If-None-Match": {`"etag"`}})
+	if body != "" {
+		t.Fatalf(body)
+	}
+	if w.Header().Get("Cache-Control") == "" || w.Header().Get("Expires") != epoch {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+}
+
+func TestStripSlashes(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Get("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("root"))
+	})
+	r.Route("/accounts", func(r stdchi.Router) {
+		r.Get("/{accountID}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.PathValue("accountID")))
+		})
+	})
+	h := StripSlashes(r)
+
+	if _, body := testRequest(t, h, "GET", "/", nil, nil); body != "root" {
+		t.Fatalf(body)
+	}
+	if _, body := testRequest(t, h, "GET", "/accounts/admin/", nil, nil); body != "admin" {
+		t.Fatalf(body)
+	}
+}
+
+func TestRedirectSlashes(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Get("/accounts/{accountID}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("accountID")))
+	})
+	h := RedirectSlashes(r)
+
+	if _, body := testRequest(t, h, "GET", "/accounts/admin", nil, nil); body != "admin" {
+		t.Fatalf(body)
+	}
+	w, _ := testRequest(t, h, "GET", "/accounts/admin/?q=1", nil, nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/accounts/admin?q=1" {
+		t.Fatalf("unexpected redirect %d %q", w.Code, w.Header().Get("Location"))
+	}
+	w, _ = testRequest(t, h, "GET", "//evil.com/", nil, nil)
+	if loc := w.Header().Get("Location"); loc != "/evil.com" {
+		t.Fatalf("unexpected redirect %q", loc)
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id")))
+	})
+	h := CleanPath(r)
+
+	if _, body := testRequest(t, h, "GET", "/users//1", nil, nil); body != "1" {
+		t.Fatalf(body)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	h := Heartbeat("/ping")(http.NotFoundHandler())
+
+	if w, body := testRequest(t, h, "GET", "/ping", nil, nil); w.Code != http.StatusOK || body != "." {
+		t.Fatalf(body)
+	}
+	if w, _ := testRequest(t, h, "GET", "/other", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+}
+
+func TestAllowContentType(t *testing.T) {
+	r := stdchi.NewRouter()
+	r.Use(AllowContentType("application/json", "Text/XML"))
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"application/json; charset=utf-8", http.StatusOK},
+		{"text/xml", http.StatusOK},
+		{"text/plain", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		w, _ := testRequest(t, r, "POST", "/", strings.NewReader("{}"), http.Header{"Content-Type": {tt.contentType}})
+		if w.Code != tt.want {
+			t.Fatalf("%s: unexpected status %d", tt.contentType, w.Code)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+
+	users := stdchi.NewRouter()
+	users.Get("/{id}", h)
+	users.Put("/{id}", h)
+
+	r := stdchi.NewRouter()
+	r.Mount("/users", users)
+	r.Post("/any", h)
+
+	cors := CORS(CORSOpts{
+		AllowedOrigins:       []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginRegexps: []string{`https://[a-z]+\.example\.net`},
+		AllowedHeaders:       []string{"Content-Type", "Authorization"},
+		ExposedHeaders:       []string{"X-Total"},
+		AllowCredentials:     true,
+		MaxAge:               600,
+	})(r)
+
+	preflight := func(origin, method, headers string) http.Header {
+		hdr := http.Header{"Origin": {origin}, "Access-Control-Request-Method": {method}}
+		if headers != "" {
+			hdr.Set("Access-Control-Request-Headers", headers)
+		}
+		w, body := testRequest(t, cors, "OPTIONS", "/users/1", nil, hdr)
+		if w.Code != http.StatusNoContent || body != "" {
+			t.Fatalf("unexpected preflight response %d %q", w.Code, body)
+		}
+		return w.Header()
+	}
+
+	hdr := preflight("https://app.example.com", "PUT", "content-type, authorization")
+	if hdr.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		hdr.Get("Access-Control-Allow-Methods") != "GET, HEAD, PUT" ||
+		hdr.Get("Access-Control-Allow-Headers") != "content-type, authorization" ||
+		hdr.Get("Access-Control-Allow-Credentials") != "true" ||
+		hdr.Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("unexpected preflight headers %v", hdr)
+	}
+	for _, origin := range []string{"https://a.b.example.org", "https://api.example.net"} {
+		if hdr := preflight(origin, "GET", ""); hdr.Get("Access-Control-Allow-Origin") != origin {
+			t.Fatalf("expecting %s to be allowed: %v", origin, hdr)
+		}
+	}
+	for _, tt := range [][3]string{
+		{"https://evil.com", "GET", ""},
+		{"https://example.org", "GET", ""},
+		{"https://app.example.com", "DELETE", ""},
+		{"https://app.example.com", "GET", "X-Secret"},
+	} {
+		if hdr := preflight(tt[0], tt[1], tt[2]); hdr.Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("expecting %v to be denied: %v", tt, hdr)
+		}
+	}
+
+	w, body := testRequest(t, cors, "GET", "/users/1", nil, http.Header{"Origin": {"https://app.example.com"}})
+	if body != "ok" || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Expose-Headers") != "X-Total" || w.Header().Get("Vary") != "Origin" {
+		t.Fatalf("unexpected response %q %v", body, w.Header())
+	}
+
+	// With Mux.Use, preflight requests are answered along AutoOptions.
+	r2 := stdchi.NewRouter()
+	r2.AutoOptions(nil)
+	r2.Use(CORS(CORSOpts{AllowedOrigins: []string{"*"}}))
+	r2.Delete("/items/{id}", h)
+	w, _ = testRequest(t, r2, "OPTIONS", "/items/1", nil, http.Header{
+		"Origin":                        {"https://any.com"},
+		"Access-Control-Request-Method": {"DELETE"},
+	})
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "DELETE, OPTIONS" {
+		t.Fatalf("unexpected preflight response %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCompress(t *testing.T) {
+	big := strings.Repeat("stdchi compress ", 100)
+
+	r := stdchi.NewRouter()
+	compressor := NewCompressor(5, "text/*", "application/json")
+	compressor.SetEncoder("x-upper", func(w io.Writer, level int) io.Writer {
+		return upperWriter{w}
+	})
+	r.Use(compressor.Handler)
+	r.Get("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(big))
+	})
+	r.Get("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	})
+	r.Get("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(big))
+	})
+	r.Get("/encoded", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte(big))
+	})
+	r.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		http.NewResponseController(w).Flush()
+		if _, _, err := http.NewResponseController(w).Hijack(); !errors.Is(err, http.ErrNotSupported) {
+			t.Errorf("expecting the hijacker of the recorder, got %v", err)
+		}
+		w.Write([]byte("data: 2\n\n"))
+	})
+
+	tests := []struct {
+		path     string
+		header   http.Header
+		encoding string
+		vary     bool
+	}{
+		{"/text", http.Header{"Accept-Encoding": {"gzip, deflate"}}, "gzip", true},
+		{"/text", http.Header{"Accept-Encoding": {"gzip;q=0.5, deflate"}}, "deflate", true},
+		{"/text", http.Header{"Accept-Encoding": {"gzip;q=0, *;q=0.1"}}, "x-upper", true},
+		{"/text", http.Header{"Accept-Encoding": {"identity"}}, "", true},
+		{"/text", http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-9"}}, "", false},
+		{"/text", nil, "", true},
+		{"/small", http.Header{"Accept-Encoding": {"gzip"}}, "", true},
+		{"/image", http.Header{"Accept-Encoding": {"gzip"}}, "", false},
+		{"/encoded", http.Header{"Accept-Encoding": {"gzip"}}, "br", false},
+	}
+	for _, tt := range tests {
+		w, body := testRequest(t, r, "GET", tt.path, nil, tt.header)
+		if w.Header().Get("Content-Encoding") != tt.encoding {
+			t.Fatalf("%s %v: expecting encoding %q, got %q", tt.path, tt.header, tt.encoding, w.Header().Get("Content-Encoding"))
+		}
+		if vary := w.Header().Get("Vary") == "Accept-Encoding"; vary != tt.vary {
+			t.Fatalf("%s %v: unexpected Vary %q", tt.path, tt.header, w.Header().Get("Vary"))
+		}
+		switch tt.encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(zr)
+			body = string(b)
+		case "deflate":
+			zr, err := zlib.NewReader(strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(zr)
+			body = string(b)
+		case "x-upper":
+			body = strings.ToLower(body)
+		}
+		if body != big && tt.path != "/small" {
+			t.Fatalf("%s %v: unexpected body %q", tt.path, tt.header, body)
+		}
+	}
+
+	w, body := testRequest(t, r, "GET", "/stream", nil, http.Header{"Accept-Encoding": {"gzip"}})
+	if w.Header().Get("Content-Encoding") != "gzip" || !w.Flushed {
+		t.Fatalf("unexpected stream response %v", w.Header())
+	}
+	zr, err := gzip.NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != "data: 1\n\ndata: 2\n\n" {
+		t.Fatalf("unexpected stream body %q", b)
+	}
+}
+
+type upperWriter struct{ w io.Writer }
+
+func (u upperWriter) Write(p []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(p))
+}
+
+func TestRateLimit(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+
+	tenants := stdchi.NewRouter()
+	tenants.Use(RateLimitWithOpts(RateLimitOpts{
+		Limit:     2,
+		Window:    time.Minute,
+		Algorithm: SlidingWindow,
+		KeyFuncs:  []KeyFunc{KeyByPathValue("tenant"), KeyByRoutePattern},
+	}))
+	tenants.Get("/items", h)
+	tenants.Get("/orders", h)
+
+	r := stdchi.NewRouter()
+	r.Mount("/t/{tenant}", tenants)
+	r.With(RateLimit(1, time.Hour)).Get("/login", h)
+
+	for i, tt := range []struct {
+		path      string
+		status    int
+		remaining string
+	}{
+		{"/t/a/items", 200, "1"},
+		{"/t/b/items", 200, "1"},
+		{"/t/a/items", 200, "0"},
+		{"/t/a/items", 429, "0"},
+		{"/t/a/orders", 200, "1"},
+		{"/login", 200, "0"},
+		{"/login", 429, "0"},
+	} {
+		w, body := testRequest(t, r, "GET", tt.path, nil, nil)
+		if w.Code != tt.status || w.Header().Get("RateLimit-Remaining") != tt.remaining {
+			t.Fatalf("%d %s: unexpected response %d %v %q", i, tt.path, w.Code, w.Header(), body)
+		}
+		if tt.status == 429 && (w.Header().Get("Retry-After") == "" ||
+			w.Header().Get("Content-Type") != "text/plain; charset=utf-8") {
+			t.Fatalf("%d %s: unexpected limited response %v %q", i, tt.path, w.Header(), body)
+		}
+	}
+	w, _ := testRequest(t, r, "GET", "/login", nil, nil)
+	if w.Header().Get("Retry-After") != "3600" || w.Header().Get("RateLimit-Limit") != "1" ||
+		w.Header().Get("RateLimit-Policy") != "1;w=3600" {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+
+	// On a parent router, the routes of a subrouter share one limit.
+	api := stdchi.NewRouter()
+	api.Get("/a", h)
+	api.Get("/b", h)
+	root := stdchi.NewRouter()
+	root.Use(RateLimit(1, time.Hour))
+	root.Mount("/api", api)
+	if w, _ := testRequest(t, root, "GET", "/api/a", nil, nil); w.Code != 200 {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if w, _ := testRequest(t, root, "GET", "/api/b", nil, nil); w.Code != 429 {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	// Stores are driven by the time passed to Take.
+	s := NewMemoryRateLimitStore()
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bucket := RateLimitRule{Algorithm: TokenBucket, Limit: 2, Window: 10 * time.Second}
+	for i, tt := range []struct {
+		after   time.Duration
+		allowed bool
+		retry   time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{time.Second, false, 4 * time.Second},
+		{4 * time.Second, true, 0},
+		{0, false, 5 * time.Second},
+	} {
+		now = now.Add(tt.after)
+		res, _ := s.Take(ctx, "k", bucket, now)
+		if res.Allowed != tt.allowed || res.RetryAfter != tt.retry {
+			t.Fatalf("bucket %d: unexpected result %+v", i, res)
+		}
+	}
+
+	window := RateLimitRule{Algorithm: SlidingWindow, Limit: 4, Window: 10 * time.Second}
+	now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		s.Take(ctx, "w", window, now)
+	}
+	if res, _ := s.Take(ctx, "w", window, now.Add(5*time.Second)); res.Allowed || res.RetryAfter != 7500*time.Millisecond {
+		t.Fatalf("unexpected window result %+v", res)
+	}
+	// Half of the previous window counts: 4*0.5 = 2 of 4.
+	if res, _ := s.Take(ctx, "w", window, now.Add(15*time.Second)); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("unexpected window result %+v", res)
+	}
+}
+
+func TestWrapResponseWriter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := NewWrapResponseWriter(w, r.ProtoMajor)
+		if _, ok := ww.(http.Flusher); !ok {
+			t.Error("expecting http.Flusher")
+		}
+		if _, ok := ww.(http.Hijacker); !ok {
+			t.Error("expecting http.Hijacker")
+		}
+		if _, ok := ww.(io.ReaderFrom); !ok {
+			t.Error("expecting io.ReaderFrom")
+		}
+		var tee bytes.Buffer
+		ww.Tee(&tee)
+		ww.Write([]byte("hello"))
+		if ww.Status() != http.StatusOK || ww.BytesWritten() != 5 || tee.String() != "hello" {
+			t.Errorf("unexpected status %d, bytes %d, tee %q", ww.Status(), ww.BytesWritten(), tee.String())
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
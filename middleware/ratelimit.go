@@ -0,0 +1,316 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/covrom/stdchi"
+)
+
+// RateLimitAlgorithm selects how requests are counted against a limit.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket allows bursts of up to Limit requests and refills the
+	// bucket at Limit requests per Window.
+	TokenBucket RateLimitAlgorithm = iota
+
+	// SlidingWindow allows Limit requests in any Window, estimated from
+	// the counts of the current and the previous fixed windows.
+	SlidingWindow
+)
+
+// RateLimitRule is the limit applied to a key.
+type RateLimitRule struct {
+	Algorithm RateLimitAlgorithm
+	Limit     int
+	Window    time.Duration
+}
+
+// RateLimitResult is the outcome of taking a request from a limit.
+type RateLimitResult struct {
+	// Allowed reports whether the request is within the limit.
+	Allowed bool
+
+	// Limit is the number of requests allowed per window.
+	Limit int
+
+	// Remaining is the number of requests left in the current window.
+	Remaining int
+
+	// Reset is the time until the limit is restored: the bucket is full
+	// again or the current window ends.
+	Reset time.Duration
+
+	// RetryAfter is the time until the next request is allowed, zero for
+	// allowed requests.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the state of the limits by key. Implementations
+// backed by shared storage let several servers enforce the same limits,
+// they must take a request atomically.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rule RateLimitRule, now time.Time) (RateLimitResult, error)
+}
+
+// KeyFunc returns a part of the key a request is rate limited by.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP keys the limit by the client IP address taken from
+// http.Request.RemoteAddr, use the RealIP middleware behind proxies.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByRoutePattern keys the limit by the route pattern matched so far,
+// so each route of the router using the middleware has its own limit.
+// Middlewares run before subrouters route the request: used on a parent
+// router, the pattern is the mount point, e.g. `/api/*`, and the routes
+// of the subrouter share one limit. Use the middleware on the subrouter
+// or with With to limit its routes separately.
+func KeyByRoutePattern(r *http.Request) string {
+	return stdchi.RoutePattern(r.Context())
+}
+
+// KeyByHeader keys the limit by the value of a request header, e.g. an
+// API key.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByPathValue keys the limit by a path value captured by the router,
+// e.g. `{tenant}` of a mount point.
+func KeyByPathValue(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return stdchi.URLParam(r, name)
+	}
+}
+
+// RateLimitOpts configures the RateLimitWithOpts middleware.
+type RateLimitOpts struct {
+	// Limit is the number of requests allowed per Window.
+	Limit int
+
+	// Window is the period of the limit.
+	Window time.Duration
+
+	// Algorithm is TokenBucket by default.
+	Algorithm RateLimitAlgorithm
+
+	// KeyFuncs build the key the requests are limited by. The default
+	// keys by KeyByIP and KeyByRoutePattern.
+	KeyFuncs []KeyFunc
+
+	// Store keeps the limits, a new in-memory store when nil. Requests
+	// are let through when the store fails.
+	Store RateLimitStore
+
+	// LimitHandler writes the response to limited requests after the
+	// headers are set. By default a 429 (Too Many Requests) error is
+	// written by the error handler of the router.
+	LimitHandler http.Handler
+}
+
+// RateLimit is a middleware that allows `limit` requests per `window` to
+// each route from each client IP address, with a token bucket. Routes of
+// subrouters mounted below the router using it share the limit of their
+// mount point, see KeyByRoutePattern.
+func RateLimit(limit int, window time.Duration) func(http.Handler) http.Handler {
+	return RateLimitWithOpts(RateLimitOpts{Limit: limit, Window: window})
+}
+
+// RateLimitWithOpts is a middleware that limits the rate of requests as
+// configured by `opts`. The responses carry the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, limited requests get
+// a 429 (Too Many Requests) status with a Retry-After header.
+func RateLimitWithOpts(opts RateLimitOpts) func(http.Handler) http.Handler {
+	if opts.Limit < 1 {
+		panic("stdchi/middleware: RateLimit expects limit > 0")
+	}
+	if opts.Window <= 0 {
+		panic("stdchi/middleware: RateLimit expects window > 0")
+	}
+
+	rule := RateLimitRule{Algorithm: opts.Algorithm, Limit: opts.Limit, Window: opts.Window}
+	keyFuncs := opts.KeyFuncs
+	if len(keyFuncs) == 0 {
+		keyFuncs = []KeyFunc{KeyByIP, KeyByRoutePattern}
+	}
+	store := opts.Store
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			parts := make([]string, len(keyFuncs))
+			for i, kf := range keyFuncs {
+				parts[i] = kf(r)
+			}
+
+			res, err := store.Take(r.Context(), strings.Join(parts, "\x00"), rule, time.Now())
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			h.Set("RateLimit-Policy", strconv.Itoa(rule.Limit)+";w="+strconv.Itoa(ceilSeconds(rule.Window)))
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+				if opts.LimitHandler != nil {
+					opts.LimitHandler.ServeHTTP(w, r)
+				} else {
+					stdchi.HandleError(w, r, &stdchi.HTTPError{Status: http.StatusTooManyRequests})
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore is a RateLimitStore keeping the limits in memory.
+// Idle keys are removed once their limit is fully available again.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+type rateLimitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	// sliding window
+	start time.Time // start of the current window
+	prev  int       // requests of the previous window
+	curr  int       // requests of the current window
+
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: map[string]*rateLimitEntry{}}
+}
+
+// Take takes a request of `key` from the limit of `rule`.
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, rule RateLimitRule, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= time.Minute {
+		for k, e := range s.entries {
+			if !now.Before(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &rateLimitEntry{tokens: float64(rule.Limit), last: now, start: now.Truncate(rule.Window)}
+		s.entries[key] = e
+	}
+
+	if rule.Algorithm == SlidingWindow {
+		return e.takeWindow(rule, now), nil
+	}
+	return e.takeToken(rule, now), nil
+}
+
+func (e *rateLimitEntry) takeToken(rule RateLimitRule, now time.Time) RateLimitResult {
+	limit := float64(rule.Limit)
+	perToken := float64(rule.Window) / limit
+
+	if elapsed := now.Sub(e.last); elapsed > 0 {
+		e.tokens = math.Min(limit, e.tokens+float64(elapsed)/perToken)
+	}
+	e.last = now
+
+	res := RateLimitResult{Limit: rule.Limit}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - e.tokens) * perToken)
+	}
+	res.Remaining = int(e.tokens)
+	res.Reset = time.Duration((limit - e.tokens) * perToken)
+	e.expires = now.Add(res.Reset)
+	return res
+}
+
+func (e *rateLimitEntry) takeWindow(rule RateLimitRule, now time.Time) RateLimitResult {
+	start := now.Truncate(rule.Window)
+	if !start.Equal(e.start) {
+		if start.Sub(e.start) == rule.Window {
+			e.prev = e.curr
+		} else {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.start = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(rule.Window)
+	count := float64(e.prev)*weight + float64(e.curr)
+
+	res := RateLimitResult{Limit: rule.Limit, Reset: rule.Window - elapsed}
+	if count+1 <= float64(rule.Limit) {
+		e.curr++
+		count++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = retryWindow(rule, e.prev, e.curr) - elapsed
+		if res.RetryAfter <= 0 {
+			// The current window is full, it becomes the previous one.
+			res.RetryAfter = rule.Window - elapsed + retryWindow(rule, e.curr, 0)
+		}
+	}
+	res.Remaining = max(rule.Limit-int(math.Ceil(count)), 0)
+	// The current window weighs on the estimate until the next one is over.
+	e.expires = start.Add(2 * rule.Window)
+	return res
+}
+
+// retryWindow returns the offset in a window with `prev` requests in the
+// previous window and `curr` in the current one from which a request is
+// allowed, zero or less when none is allowed until the window is over.
+func retryWindow(rule RateLimitRule, prev, curr int) time.Duration {
+	free := float64(rule.Limit - 1 - curr)
+	if free < 0 {
+		return 0
+	}
+	if prev == 0 {
+		return 0
+	}
+	return time.Duration(math.Max(1-free/float64(prev), 0) * float64(rule.Window))
+}
@@ -0,0 +1,140 @@
+package middleware
+
+// The original work was derived from Goji's middleware, source:
+// https://github.com/zenazn/goji/tree/master/web/middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+
+	"github.com/covrom/stdchi"
+)
+
+// RecovererOpts configures the RecovererWithOpts middleware.
+type RecovererOpts struct {
+	// Logger logs the panics with the stack and the matched route pattern.
+	// When nil, panics are logged through the LogEntry of the request if
+	// any, or printed to standard error.
+	Logger *slog.Logger
+
+	// Render writes the response after a panic, a bare 500 (Internal Server
+	// Error) status when nil.
+	Render http.Handler
+
+	// ErrorHandler, when set, receives the panics converted to a
+	// *PanicError and writes the response instead of Render.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// PanicError is a panic recovered by the Recoverer middleware.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Pattern is the route pattern matched for the request.
+	Pattern string
+
+	// Stack is the stack of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Recoverer is a middleware that recovers from panics, logs the panic (and a
+// backtrace), and returns a HTTP 500 (Internal Server Error) status if
+// possible. Recoverer prints a request ID if one is provided.
+//
+// http.ErrAbortHandler panics are passed through, net/http uses them to
+// abort the response silently.
+func Recoverer(next http.Handler) http.Handler {
+	return RecovererWithOpts(RecovererOpts{})(next)
+}
+
+// RecovererWithOpts is a middleware that recovers from panics like
+// Recoverer, logging and rendering them as configured by `opts`.
+func RecovererWithOpts(opts RecovererOpts) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rvr := recover(); rvr != nil {
+					if rvr == http.ErrAbortHandler {
+						// we don't recover http.ErrAbortHandler so the response
+						// to the client is aborted, this should not be logged
+						panic(rvr)
+					}
+
+					perr := &PanicError{
+						Value:   rvr,
+						Pattern: stdchi.RoutePattern(r.Context()),
+						Stack:   debug.Stack(),
+					}
+
+					switch logEntry := GetLogEntry(r); {
+					case opts.Logger != nil:
+						opts.Logger.ErrorContext(r.Context(), "panic recovered",
+							slog.Any("panic", rvr),
+							slog.String("method", r.Method),
+							slog.String("pattern", perr.Pattern),
+							slog.String("path", r.URL.Path),
+							slog.String("request_id", GetReqID(r.Context())),
+							slog.String("stack", string(perr.Stack)),
+						)
+					case logEntry != nil:
+						logEntry.Panic(rvr, perr.Stack)
+					default:
+						printPanic(rvr, perr.Pattern, perr.Stack)
+					}
+
+					if r.Header.Get("Connection") == "Upgrade" {
+						return
+					}
+					switch {
+					case opts.ErrorHandler != nil:
+						opts.ErrorHandler(w, r, perr)
+					case opts.Render != nil:
+						opts.Render.ServeHTTP(w, r)
+					default:
+						w.WriteHeader(http.StatusInternalServerError)
+					}
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// recovererErrorWriter is the writer PrintPrettyStack prints to.
+var recovererErrorWriter io.Writer = os.Stderr
+
+// PrintPrettyStack prints the panic value and the stack of the current
+// goroutine to standard error, highlighting the panic in color on a TTY.
+func PrintPrettyStack(rvr interface{}) {
+	printPanic(rvr, "", debug.Stack())
+}
+
+func printPanic(rvr interface{}, pattern string, stack []byte) {
+	var buf bytes.Buffer
+	cW(&buf, true, bRed, "panic: ")
+	cW(&buf, true, bWhite, "%v", rvr)
+	if pattern != "" {
+		cW(&buf, true, nCyan, " [%s]", pattern)
+	}
+	buf.WriteString("\n\n")
+	cW(&buf, true, nBlack, "%s", bytes.TrimSpace(stack))
+	buf.WriteString("\n")
+	fmt.Fprint(recovererErrorWriter, buf.String())
+}
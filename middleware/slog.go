@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/covrom/stdchi"
+)
+
+// SlogOpts configures the SlogLoggerWithOpts middleware.
+type SlogOpts struct {
+	// Logger receives the records, slog.Default() when nil.
+	Logger *slog.Logger
+
+	// Message of the records, "request" when empty.
+	Message string
+
+	// StatusLevels maps a status class (the status code divided by 100,
+	// e.g. 4 for 404) to the level of the record. Missing classes log
+	// 5xx at slog.LevelError, 4xx at slog.LevelWarn and others at
+	// slog.LevelInfo.
+	StatusLevels map[int]slog.Level
+
+	// Redact lists the path values and attributes, like `token` or
+	// `remote_addr`, whose values are replaced with "[REDACTED]".
+	// Names are case-insensitive.
+	Redact []string
+}
+
+// SlogLogger is a middleware that logs one structured record per request to
+// `logger`, once the request has been served. See SlogLoggerWithOpts.
+func SlogLogger(logger *slog.Logger) func(next http.Handler) http.Handler {
+	return SlogLoggerWithOpts(SlogOpts{Logger: logger})
+}
+
+// SlogLoggerWithOpts is a middleware that logs one structured record per
+// request with the method, path, full route pattern matched across all
+// Mount levels, path values, status, bytes written, duration, remote address
+// and the request ID set by RequestID.
+//
+// Used with Mux.Use on the root router, it still sees the pattern and the
+// path values of the innermost mounted subrouter.
+func SlogLoggerWithOpts(opts SlogOpts) func(next http.Handler) http.Handler {
+	msg := opts.Message
+	if msg == "" {
+		msg = "request"
+	}
+	redact := make(map[string]bool, len(opts.Redact))
+	for _, k := range opts.Redact {
+		redact[strings.ToLower(k)] = true
+	}
+	attr := func(key string, v slog.Value) slog.Attr {
+		if redact[strings.ToLower(key)] {
+			return slog.String(key, "[REDACTED]")
+		}
+		return slog.Attr{Key: key, Value: v}
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			logger := opts.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			ww := NewWrapResponseWriter(w, r.ProtoMajor)
+
+			t1 := time.Now()
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				level, ok := opts.StatusLevels[status/100]
+				if !ok {
+					level = defaultStatusLevel(status)
+				}
+				ctx := r.Context()
+				if !logger.Enabled(ctx, level) {
+					return
+				}
+
+				attrs := []slog.Attr{
+					attr("method", slog.StringValue(r.Method)),
+					attr("path", slog.StringValue(r.URL.Path)),
+					attr("pattern", slog.StringValue(stdchi.RoutePattern(ctx))),
+				}
+				if values := stdchi.PathValues(r); len(values) > 0 {
+					pv := make([]any, 0, len(values))
+					for k, v := range values {
+						pv = append(pv, attr(k, slog.StringValue(v)))
+					}
+					attrs = append(attrs, slog.Group("path_values", pv...))
+				}
+				attrs = append(attrs,
+					attr("status", slog.IntValue(status)),
+					attr("bytes", slog.IntValue(ww.BytesWritten())),
+					attr("duration", slog.DurationValue(time.Since(t1))),
+					attr("remote_addr", slog.StringValue(r.RemoteAddr)),
+				)
+				if reqID := GetReqID(ctx); reqID != "" {
+					attrs = append(attrs, attr("request_id", slog.StringValue(reqID)))
+				}
+				logger.LogAttrs(ctx, level, msg, attrs...)
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func defaultStatusLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/covrom/stdchi"
+)
+
+const (
+	errCapacityExceeded = "Server capacity exceeded."
+	errTimedOut         = "Timed out while waiting for a pending request to complete."
+	errContextCanceled  = "Context was canceled."
+)
+
+var (
+	defaultBacklogTimeout = time.Second * 60
+)
+
+// ThrottleOpts represents a set of throttling options.
+type ThrottleOpts struct {
+	// RetryAfterFn returns the Retry-After duration of rejected requests,
+	// `ctxDone` is set when the request context is done. The default
+	// suggests the backlog timeout, or a second without backlog.
+	RetryAfterFn func(ctxDone bool) time.Duration
+
+	// Limit is the maximum number of requests processed at a time.
+	Limit int
+
+	// BacklogLimit is the maximum number of requests waiting for one of
+	// the processed requests to complete.
+	BacklogLimit int
+
+	// BacklogTimeout is the maximum time a request waits in the backlog.
+	BacklogTimeout time.Duration
+
+	// StatusCode of rejected requests, 503 (Service Unavailable) by default.
+	// The response is written by the error handler of the router.
+	StatusCode int
+}
+
+// ThrottleStats are the live counters of a Throttler.
+type ThrottleStats struct {
+	// InFlight is the number of requests being processed.
+	InFlight int64
+
+	// Waiting is the number of requests waiting in the backlog.
+	Waiting int64
+
+	// Served is the total number of processed requests.
+	Served int64
+
+	// Rejected is the total number of rejected requests.
+	Rejected int64
+}
+
+// Throttle is a middleware that limits number of currently processed requests
+// at a time across all users. Note: Throttle is not a rate-limiter per user,
+// instead it just puts a ceiling on the number of current in-flight requests
+// being processed from the point from where the Throttle middleware is mounted.
+//
+// The limit is shared by all the routes of a router when the middleware is
+// registered with Use, and applies to a single route with With.
+func Throttle(limit int) func(http.Handler) http.Handler {
+	return ThrottleWithOpts(ThrottleOpts{Limit: limit, BacklogTimeout: defaultBacklogTimeout})
+}
+
+// ThrottleBacklog is a middleware that limits number of currently processed
+// requests at a time and provides a backlog for holding a finite number of
+// pending requests.
+func ThrottleBacklog(limit, backlogLimit int, backlogTimeout time.Duration) func(http.Handler) http.Handler {
+	return ThrottleWithOpts(ThrottleOpts{Limit: limit, BacklogLimit: backlogLimit, BacklogTimeout: backlogTimeout})
+}
+
+// ThrottleWithOpts is a middleware that limits number of currently processed requests using passed ThrottleOpts.
+func ThrottleWithOpts(opts ThrottleOpts) func(http.Handler) http.Handler {
+	return NewThrottler(opts).Handler
+}
+
+// Throttler limits the number of requests processed at a time and keeps
+// the counters of its requests, e.g. to export them as metrics.
+type Throttler struct {
+	tokens         chan token
+	backlogTokens  chan token
+	retryAfterFn   func(ctxDone bool) time.Duration
+	backlogTimeout time.Duration
+	statusCode     int
+
+	inFlight atomic.Int64
+	waiting  atomic.Int64
+	served   atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewThrottler creates a new Throttler configured by `opts`, its Handler
+// is the middleware.
+func NewThrottler(opts ThrottleOpts) *Throttler {
+	if opts.Limit < 1 {
+		panic("stdchi/middleware: Throttle expects limit > 0")
+	}
+
+	if opts.BacklogLimit < 0 {
+		panic("stdchi/middleware: Throttle expects backlogLimit to be positive")
+	}
+
+	statusCode := opts.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	retryAfterFn := opts.RetryAfterFn
+	if retryAfterFn == nil {
+		retryAfter := time.Second
+		if opts.BacklogLimit > 0 && opts.BacklogTimeout > retryAfter {
+			retryAfter = opts.BacklogTimeout
+		}
+		retryAfterFn = func(bool) time.Duration { return retryAfter }
+	}
+
+	t := &Throttler{
+		tokens:         make(chan token, opts.Limit),
+		backlogTokens:  make(chan token, opts.Limit+opts.BacklogLimit),
+		backlogTimeout: opts.BacklogTimeout,
+		statusCode:     statusCode,
+		retryAfterFn:   retryAfterFn,
+	}
+
+	// Filling tokens.
+	for i := 0; i < opts.Limit+opts.BacklogLimit; i++ {
+		if i < opts.Limit {
+			t.tokens <- token{}
+		}
+		t.backlogTokens <- token{}
+	}
+
+	return t
+}
+
+// Stats returns the current counters of the Throttler.
+func (t *Throttler) Stats() ThrottleStats {
+	return ThrottleStats{
+		InFlight: t.inFlight.Load(),
+		Waiting:  t.waiting.Load(),
+		Served:   t.served.Load(),
+		Rejected: t.rejected.Load(),
+	}
+}
+
+// Handler returns the middleware throttling the requests to `next`.
+func (t *Throttler) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		select {
+
+		case <-ctx.Done():
+			t.reject(w, r, errContextCanceled, true)
+			return
+
+		case btok := <-t.backlogTokens:
+			timer := time.NewTimer(t.backlogTimeout)
+			t.waiting.Add(1)
+
+			defer func() {
+				t.backlogTokens <- btok
+			}()
+
+			select {
+			case <-timer.C:
+				t.waiting.Add(-1)
+				t.reject(w, r, errTimedOut, false)
+				return
+			case <-ctx.Done():
+				timer.Stop()
+				t.waiting.Add(-1)
+				t.reject(w, r, errContextCanceled, true)
+				return
+			case tok := <-t.tokens:
+				t.waiting.Add(-1)
+				t.inFlight.Add(1)
+				defer func() {
+					timer.Stop()
+					t.inFlight.Add(-1)
+					t.served.Add(1)
+					t.tokens <- tok
+				}()
+				next.ServeHTTP(w, r)
+			}
+			return
+
+		default:
+			t.reject(w, r, errCapacityExceeded, false)
+			return
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// reject responds to a request the Throttler couldn't process, with the
+// error handler of the router.
+func (t *Throttler) reject(w http.ResponseWriter, r *http.Request, msg string, ctxDone bool) {
+	t.rejected.Add(1)
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(t.retryAfterFn(ctxDone))))
+	stdchi.HandleError(w, r, &stdchi.HTTPError{Status: t.statusCode, Message: msg})
+}
+
+// token represents a request that is being processed.
+type token struct{}
@@ -0,0 +1,256 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/covrom/stdchi"
+)
+
+// Timeout is a middleware that cancels ctx after a given timeout and return
+// a 504 Gateway Timeout error to the client.
+//
+// It's required that you select the ctx.Done() channel to check for the signal
+// if the context has reached its deadline and return, otherwise the timeout
+// signal will be just ignored.
+//
+// ie. a route/handler may look like:
+//
+//	r.Get("/long", func(w http.ResponseWriter, r *http.Request) {
+//		ctx := r.Context()
+//		processTime := time.Duration(rand.Intn(4)+1) * time.Second
+//
+//		select {
+//		case <-ctx.Done():
+//			return
+//
+//		case <-time.After(processTime):
+//			// The above channel simulates some hard work.
+//		}
+//
+//		w.Write([]byte("done"))
+//	})
+//
+// Unlike http.TimeoutHandler the response is not buffered. When the handler
+// hasn't written the headers by the deadline, the 504 of the error handler of
+// the router is sent whole right away, so the client doesn't wait for the
+// handler, and the later writes of the handler fail with
+// http.ErrHandlerTimeout. Responses started before the deadline are left
+// to the handler.
+//
+// The error handler writing the 504 runs while the handler, or the
+// subrouters still routing the request, may be running too. It sees the
+// route matched so far, RoutePattern and PathValues are safe to call.
+//
+// Use it with With or Group to set the timeout of some routes. Nested
+// timeouts can't extend the deadline, the earliest one wins.
+func Timeout(timeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+			stop := context.AfterFunc(ctx, func() {
+				if ctx.Err() == context.DeadlineExceeded {
+					tw.timeout(r)
+				}
+			})
+			defer func() {
+				stop()
+				tw.finish(r)
+			}()
+
+			next.ServeHTTP(tw, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// timeoutWriter guards the response of a handler run with a deadline: it
+// keeps the headers of the handler apart until they are written, so the
+// timeout response can be written concurrently, and discards the writes
+// made after it.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header // The headers of the handler until they are written.
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+	done        bool // The handler returned.
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.wroteHeader && !tw.timedOut {
+		// Trailers are set on the header of the response.
+		return tw.w.Header()
+	}
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.copyHeaderLocked()
+	tw.w.WriteHeader(code)
+	// Informational responses are followed by the final one.
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		tw.wroteHeader = true
+	}
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(p)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.FlushError()
+}
+
+func (tw *timeoutWriter) FlushError() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return http.NewResponseController(tw.w).Flush()
+}
+
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	hj, ok := tw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("stdchi/middleware: http.Hijacker is unavailable on the writer: %w", http.ErrNotSupported)
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		// The connection belongs to the handler now.
+		tw.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+func (tw *timeoutWriter) Push(target string, opts *http.PushOptions) error {
+	if ps, ok := tw.w.(http.Pusher); ok {
+		return ps.Push(target, opts)
+	}
+	return fmt.Errorf("stdchi/middleware: http.Pusher is unavailable on the writer: %w", http.ErrNotSupported)
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// timeout writes the timeout response unless the handler has written the
+// headers or returned.
+func (tw *timeoutWriter) timeout(r *http.Request) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.wroteHeader || tw.done {
+		return
+	}
+	tw.writeTimeoutLocked(r)
+	// Send the response while the handler is still running.
+	http.NewResponseController(tw.w).Flush()
+}
+
+// writeTimeoutLocked writes the timeout response of the error handler as
+// a whole, with its Content-Length, so the client has it complete even
+// while the handler is still running.
+func (tw *timeoutWriter) writeTimeoutLocked(r *http.Request) {
+	tw.timedOut = true
+	rec := &timeoutRecorder{header: tw.w.Header()}
+	stdchi.HandleError(rec, r, &stdchi.HTTPError{Status: http.StatusGatewayTimeout})
+	if rec.status == 0 {
+		rec.status = http.StatusGatewayTimeout
+	}
+	rec.header.Set("Content-Length", strconv.Itoa(rec.body.Len()))
+	tw.w.WriteHeader(rec.status)
+	tw.w.Write(rec.body.Bytes())
+}
+
+// timeoutRecorder captures the timeout response written by the error
+// handler, writing its headers to the response directly.
+type timeoutRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *timeoutRecorder) Header() http.Header { return rec.header }
+
+func (rec *timeoutRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+}
+
+func (rec *timeoutRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(p)
+}
+
+// finish completes the response after the handler returned. A handler
+// that hasn't written anything past the deadline gets the timeout response.
+func (tw *timeoutWriter) finish(r *http.Request) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.done = true
+	if tw.wroteHeader || tw.timedOut {
+		return
+	}
+	if r.Context().Err() == context.DeadlineExceeded {
+		tw.writeTimeoutLocked(r)
+		return
+	}
+	// Let the server send the headers set by the handler.
+	tw.copyHeaderLocked()
+}
+
+// copyHeaderLocked replaces the headers of the response with the headers
+// of the handler.
+func (tw *timeoutWriter) copyHeaderLocked() {
+	dst := tw.w.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+}
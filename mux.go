@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var _ Router = &Mux{}
@@ -12,6 +14,49 @@ var _ Router = &Mux{}
 type Mux struct {
 	stdmux      *http.ServeMux
 	middlewares []func(http.Handler) http.Handler
+
+	// mwsGen is bumped by Use to invalidate the middleware chains
+	// compiled for the routes of the Mux.
+	mwsGen atomic.Uint64
+
+	// parent is the Mux an inline-Mux was derived from with With/Group,
+	// or the Mux a subrouter was mounted on.
+	parent *Mux
+	inline bool
+
+	// Custom route not found and method not allowed handlers,
+	// inherited by subrouters unless they override them.
+	notFoundHandler         http.HandlerFunc
+	methodNotAllowedHandler http.HandlerFunc
+
+	// optionsHandler answers OPTIONS requests when enabled with AutoOptions.
+	optionsHandler http.HandlerFunc
+
+	// errorHandler writes the errors returned by HandlerFuncE routes.
+	errorHandler ErrorHandlerFunc
+
+	// routes records every registration on the routing tree
+	// in registration order.
+	routes []*route
+
+	// name is given to the routes registered on an inline-Mux
+	// returned by Name.
+	name string
+
+	// meta is attached to the routes registered on an inline-Mux
+	// returned by Meta, and on the inline-Muxes derived from it.
+	meta []any
+
+	// hosts are the subrouters added with Host, literal hosts first.
+	hosts []*hostRoute
+
+	// errs collects registration errors while Register runs.
+	errs *errCollector
+
+	// methods are the custom HTTP methods registered on the Mux,
+	// supported by its subrouters too.
+	methodsMu sync.RWMutex
+	methods   map[string]struct{}
 }
 
 func NewMux() *Mux {
@@ -20,41 +65,166 @@ func NewMux() *Mux {
 }
 
 func (mx *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	mx.stdmux.ServeHTTP(w, r)
+	r, rc := mx.newRouteCtx(r)
+	if base := mx.base(); len(base.hosts) > 0 {
+		if hr, params := base.routeHost(r); hr != nil {
+			base.serveHost(w, r, rc, hr, params)
+			return
+		}
+	}
+
+	if r.RequestURI == "*" {
+		mx.stdmux.ServeHTTP(w, r)
+		return
+	}
+
+	// The matched route takes the response writer back from the recorder,
+	// see mwsHandler, otherwise the recorder captures the response of
+	// http.ServeMux: 404 or 405 with the methods it would allow.
+	rc.fallback.w = w
+	mx.stdmux.ServeHTTP(&rc.fallback, r)
+	if rc.matched || rc.fallback.passed {
+		return
+	}
+	mx.fallback(w, r, &rc.fallback)
 }
 
-func (mx *Mux) mwsHandler(pattern string, h http.Handler) http.Handler {
-	h2 := mwWildcards(pattern, h)
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		chain(mx.middlewares, h2).ServeHTTP(w, r)
-	})
+// fallback responds to a request no route matched, with the NotFound,
+// MethodNotAllowed or AutoOptions handlers. The built-in responses are
+// written as problem details.
+func (mx *Mux) fallback(w http.ResponseWriter, r *http.Request, rec *fallbackRecorder) {
+	switch rec.status {
+	case http.StatusNotFound:
+		mx.notFound(w, r)
+	case http.StatusMethodNotAllowed:
+		opts := mx.autoOptions()
+		allow := rec.header.Get("Allow")
+		if opts != nil {
+			allow = addMethod(allow, http.MethodOptions)
+		}
+		w.Header().Set("Allow", allow)
+		switch mna := mx.customMethodNotAllowed(); {
+		case opts != nil && r.Method == http.MethodOptions:
+			chain(mx.middlewares, opts).ServeHTTP(w, r)
+		case mna != nil:
+			chain(mx.middlewares, mna).ServeHTTP(w, r)
+		default:
+			methodNotAllowedHandler(w, r)
+		}
+	}
+}
+
+// fallbackRecorder captures the status and headers written by
+// the http.ServeMux fallback handlers, discarding the body.
+// Other responses, like redirects, are passed on to `w` if set.
+type fallbackRecorder struct {
+	w      http.ResponseWriter // response of the request, if any
+	header http.Header
+	status int
+	passed bool // the response is passed on to w
+}
+
+func (rec *fallbackRecorder) Header() http.Header {
+	if rec.header == nil {
+		rec.header = http.Header{}
+	}
+	return rec.header
+}
+
+func (rec *fallbackRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.passed {
+		return rec.w.Write(b)
+	}
+	return len(b), nil
+}
+
+func (rec *fallbackRecorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+	if rec.w != nil && status != http.StatusNotFound && status != http.StatusMethodNotAllowed {
+		h := rec.w.Header()
+		for k, v := range rec.header {
+			h[k] = v
+		}
+		rec.w.WriteHeader(status)
+		rec.passed = true
+	}
 }
 
-func mwWildcards(pattern string, next http.Handler) http.Handler {
+// notFound responds with the NotFound handler of the Mux, running
+// through the middleware stack when it is a custom one.
+func (mx *Mux) notFound(w http.ResponseWriter, r *http.Request) {
+	if nf := mx.customNotFound(); nf != nil {
+		chain(mx.middlewares, nf).ServeHTTP(w, r)
+		return
+	}
+	notFoundHandler(w, r)
+}
+
+func (mx *Mux) mwsHandler(pattern string, cons []pathConstraint, h http.Handler) http.Handler {
 	wilds := uniWildcards(pattern)
+	star := strings.HasSuffix(pattern, "/*")
+	var next *Mux
+	if mh, ok := h.(*mountHandler); ok {
+		next = mh.sub
+	}
+	var cache atomic.Pointer[compiledChain]
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		wcs := wildcardsFromContext(ctx)
-		for _, ws := range wilds {
-			wcs[ws] = r.PathValue(ws)
+		rc := routeCtxFromContext(r.Context())
+		if rc == nil {
+			r, rc = mx.newRouteCtx(r)
+		}
+		rc.matched = true
+		if rec, ok := w.(*fallbackRecorder); ok {
+			w = rec.w
 		}
-		ctx = withWildcards(ctx, wcs)
-		r = r.WithContext(ctx)
-		for k, v := range wcs {
+
+		// A value not matching its constraint means the route doesn't match.
+		for _, c := range cons {
+			if !c.re.MatchString(r.PathValue(c.name)) {
+				mx.notFound(w, r)
+				return
+			}
+		}
+		rc.next = next
+		rc.match(r, pattern, wilds, star, mx)
+		// The request is the copy made for the routing level by ServeHTTP.
+		for k, v := range rc.values {
 			r.SetPathValue(k, v)
 		}
-		next.ServeHTTP(w, r)
+		mx.compiledChain(&cache, h).ServeHTTP(w, r)
 	})
 }
 
+// compiledChain returns the middleware chain of the Mux built around
+// endpoint `h`. The chain is built on the first request and rebuilt only
+// after the middleware stack has changed with Use.
+func (mx *Mux) compiledChain(cache *atomic.Pointer[compiledChain], h http.Handler) http.Handler {
+	gen := mx.mwsGen.Load()
+	if c := cache.Load(); c != nil && c.gen == gen {
+		return c.handler
+	}
+	c := &compiledChain{gen: gen, handler: chain(mx.middlewares, h)}
+	cache.Store(c)
+	return c.handler
+}
+
 // Use appends a middleware handler to the Mux middleware stack.
 //
 // The middleware stack for any Mux will execute before searching for a matching
 // route to a specific handler, which provides opportunity to respond early,
 // change the course of the request execution, or set request-scoped values for
 // the next http.Handler.
+//
+// Middlewares added after routes have been registered still apply to them.
 func (mx *Mux) Use(middlewares ...func(http.Handler) http.Handler) {
 	mx.middlewares = append(mx.middlewares, middlewares...)
+	mx.mwsGen.Add(1)
 }
 
 // Handle adds the route `pattern` that matches any http method to
@@ -66,7 +236,7 @@ func (mx *Mux) Handle(pattern string, handler http.Handler) {
 		return
 	}
 
-	mx.handle(mALL, pattern, handler)
+	mx.handle("", pattern, handler)
 }
 
 // HandleFunc adds the route `pattern` that matches any http method to
@@ -78,15 +248,16 @@ func (mx *Mux) HandleFunc(pattern string, handlerFn http.HandlerFunc) {
 		return
 	}
 
-	mx.handle(mALL, pattern, handlerFn)
+	mx.handle("", pattern, handlerFn)
 }
 
 // Method adds the route `pattern` that matches `method` http method to
 // execute the `handler` http.Handler.
 func (mx *Mux) Method(method, pattern string, handler http.Handler) {
-	m, ok := methodMap[strings.ToUpper(method)]
-	if !ok {
-		panic(fmt.Sprintf("stdchi: '%s' http method is not supported.", method))
+	m := strings.ToUpper(method)
+	if !mx.supportsMethod(m) {
+		mx.fail(method, pattern, fmt.Errorf("stdchi: '%s' http method is not supported.", method))
+		return
 	}
 	mx.handle(m, pattern, handler)
 }
@@ -100,55 +271,55 @@ func (mx *Mux) MethodFunc(method, pattern string, handlerFn http.HandlerFunc) {
 // Connect adds the route `pattern` that matches a CONNECT http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Connect(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mCONNECT, pattern, handlerFn)
+	mx.handle(http.MethodConnect, pattern, handlerFn)
 }
 
 // Delete adds the route `pattern` that matches a DELETE http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Delete(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mDELETE, pattern, handlerFn)
+	mx.handle(http.MethodDelete, pattern, handlerFn)
 }
 
 // Get adds the route `pattern` that matches a GET http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Get(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mGET, pattern, handlerFn)
+	mx.handle(http.MethodGet, pattern, handlerFn)
 }
 
 // Head adds the route `pattern` that matches a HEAD http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Head(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mHEAD, pattern, handlerFn)
+	mx.handle(http.MethodHead, pattern, handlerFn)
 }
 
 // Options adds the route `pattern` that matches an OPTIONS http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Options(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mOPTIONS, pattern, handlerFn)
+	mx.handle(http.MethodOptions, pattern, handlerFn)
 }
 
 // Patch adds the route `pattern` that matches a PATCH http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Patch(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mPATCH, pattern, handlerFn)
+	mx.handle(http.MethodPatch, pattern, handlerFn)
 }
 
 // Post adds the route `pattern` that matches a POST http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Post(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mPOST, pattern, handlerFn)
+	mx.handle(http.MethodPost, pattern, handlerFn)
 }
 
 // Put adds the route `pattern` that matches a PUT http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Put(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mPUT, pattern, handlerFn)
+	mx.handle(http.MethodPut, pattern, handlerFn)
 }
 
 // Trace adds the route `pattern` that matches a TRACE http method to
 // execute the `handlerFn` http.HandlerFunc.
 func (mx *Mux) Trace(pattern string, handlerFn http.HandlerFunc) {
-	mx.handle(mTRACE, pattern, handlerFn)
+	mx.handle(http.MethodTrace, pattern, handlerFn)
 }
 
 // With adds inline middlewares for an endpoint handler.
@@ -158,6 +329,9 @@ func (mx *Mux) With(middlewares ...func(http.Handler) http.Handler) Router {
 	im := &Mux{
 		stdmux:      mx.stdmux,
 		middlewares: mws,
+		parent:      mx,
+		inline:      true,
+		meta:        mx.meta,
 	}
 
 	return im
@@ -174,13 +348,24 @@ func (mx *Mux) Group(fn func(r Router)) Router {
 	return im
 }
 
+// Meta returns an inline-Mux attaching `meta` to the routes registered on
+// it and on the inline-Muxes derived from it with With and Group, e.g.
+// OpenAPI operation details. The metadata is listed by Routes.
+func (mx *Mux) Meta(meta ...any) Router {
+	im := mx.With().(*Mux)
+	im.meta = append(mx.meta[:len(mx.meta):len(mx.meta)], meta...)
+	return im
+}
+
 // Route creates a new Mux and mounts it along the `pattern` as a subrouter.
 // Effectively, this is a short-hand call to Mount. See _examples/.
 func (mx *Mux) Route(pattern string, fn func(r Router)) Router {
+	subRouter := NewRouter()
+	subRouter.parent = mx
 	if fn == nil {
-		panic(fmt.Sprintf("stdchi: attempting to Route() a nil subrouter on '%s'", pattern))
+		mx.fail("", pattern, fmt.Errorf("stdchi: attempting to Route() a nil subrouter on '%s'", pattern))
+		return subRouter
 	}
-	subRouter := NewRouter()
 	fn(subRouter)
 	mx.Mount(pattern, subRouter)
 	return subRouter
@@ -195,14 +380,53 @@ func (mx *Mux) Route(pattern string, fn func(r Router)) Router {
 // if you define two Mount() routes on the exact same pattern the mount will panic.
 func (mx *Mux) Mount(pattern string, handler http.Handler) {
 	if handler == nil {
-		panic(fmt.Sprintf("stdchi: attempting to Mount() a nil handler on '%s'", pattern))
+		mx.fail("", pattern, fmt.Errorf("stdchi: attempting to Mount() a nil handler on '%s'", pattern))
+		return
+	}
+
+	if host, path, ok := splitHostPattern(pattern); ok {
+		mx.hostRouter(host).Mount(path, handler)
+		return
 	}
 
+	pattern = strings.TrimSuffix(pattern, "*")
 	if pattern == "" || (pattern[len(pattern)-1] != '/' && !strings.HasSuffix(pattern, "...}")) {
 		pattern += "/"
 	}
 
-	mx.handle(mALL, pattern, StripSegments(pattern, handler))
+	rt := mx.handle("", pattern, &mountHandler{StripSegments(pattern, handler), muxOf(handler)})
+	if rt == nil {
+		return
+	}
+	rt.subroutes = routesOf(handler)
+
+	// Subrouters inherit the NotFound and MethodNotAllowed handlers
+	// unless they set their own.
+	if subr := muxOf(handler); subr != nil && subr.parent == nil && subr != mx {
+		subr.parent = mx
+	}
+}
+
+// mountHandler is the handler of a Mount route. The requests it hands
+// down to the subrouter `sub` continue their routing there.
+type mountHandler struct {
+	http.Handler
+	sub *Mux
+}
+
+// muxOf returns the *Mux behind a handler, looking through
+// handlers built with Chain.
+func muxOf(h http.Handler) *Mux {
+	for {
+		switch v := h.(type) {
+		case *Mux:
+			return v
+		case *ChainHandler:
+			h = v.Endpoint
+		default:
+			return nil
+		}
+	}
 }
 
 // StripSegments works like http.StripPrefix, but skips entire segments (including wildcards) and provides path values ​​to subrouters.
@@ -222,16 +446,20 @@ func StripSegments(pat string, h http.Handler) http.Handler {
 			r2.URL.Path = p
 			r2.URL.RawPath = rp
 
-			ctx := r.Context()
-			wcs := wildcardsFromContext(ctx)
-			for _, ws := range wilds {
-				if ws == "" {
-					continue
+			// The values are collected by the Mux routing the request,
+			// otherwise they are provided in the context.
+			if ctx := r.Context(); routeCtxFromContext(ctx) == nil {
+				wcs := wildcardValues{}
+				for k, v := range wildcardsFromContext(ctx) {
+					wcs[k] = v
+				}
+				for _, ws := range wilds {
+					if ws != "" {
+						wcs[ws] = r.PathValue(ws)
+					}
 				}
-				wcs[ws] = r.PathValue(ws)
+				r2 = r2.WithContext(withWildcards(ctx, wcs))
 			}
-			ctx = withWildcards(ctx, wcs)
-			r2 = r2.WithContext(ctx)
 			h.ServeHTTP(w, r2)
 		} else {
 			h.ServeHTTP(w, r)
@@ -239,25 +467,360 @@ func StripSegments(pat string, h http.Handler) http.Handler {
 	})
 }
 
+// Routes returns a slice of routing information from the routing tree,
+// useful for traversing available routes of a router.
+func (mx *Mux) Routes() []Route {
+	base := mx.base()
+	routes := []Route{}
+	idx := map[string]int{}
+	for _, rt := range base.routes {
+		i, ok := idx[rt.pattern]
+		if !ok {
+			i = len(routes)
+			idx[rt.pattern] = i
+			routes = append(routes, Route{Pattern: rt.pattern, Handlers: map[string]http.Handler{}})
+		}
+		h := rt.handler
+		if mws := rt.mux.inlineMiddlewares(); len(mws) > 0 {
+			h = mws.Handler(h)
+		}
+		method := rt.method
+		if method == "" {
+			method = "*"
+		}
+		routes[i].Handlers[method] = h
+		if len(rt.meta) > 0 {
+			if routes[i].Meta == nil {
+				routes[i].Meta = map[string][]any{}
+			}
+			routes[i].Meta[method] = rt.meta
+		}
+		if rt.subroutes != nil {
+			routes[i].SubRoutes = rt.subroutes
+		}
+	}
+	for _, hr := range base.hosts {
+		routes = append(routes, Route{
+			Pattern:   hr.pattern + "/",
+			Handlers:  map[string]http.Handler{"*": hr.mux},
+			SubRoutes: hr.mux,
+		})
+	}
+	return routes
+}
+
 // Middlewares returns a slice of middleware handler functions.
 func (mx *Mux) Middlewares() Middlewares {
 	return mx.middlewares
 }
 
+// Match searches the routing tree for a handler that matches the method/path.
+// It's similar to routing a http request, but without executing the handler
+// thereafter.
+func (mx *Mux) Match(method, path string) bool {
+	pattern, _ := mx.Find(method, path)
+	return pattern != ""
+}
+
+// Find searches the routing tree for a handler that matches the method/path
+// and returns its full pattern along mounted subrouters with the path values
+// captured on the way. The pattern is empty when nothing matches.
+//
+// Routes of Host subrouters are found with a `host/path` path.
+func (mx *Mux) Find(method, path string) (string, map[string]string) {
+	if host, hostPath, ok := splitHostPattern(path); ok {
+		hr, params := mx.base().matchHost(host)
+		if hr == nil {
+			return mx.Find(method, hostPath)
+		}
+		subPattern, subParams := hr.mux.Find(method, hostPath)
+		if subPattern == "" {
+			return mx.Find(method, hostPath)
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		for k, v := range subParams {
+			params[k] = v
+		}
+		return joinPatterns(hr.pattern+"/", subPattern), params
+	}
+
+	r := &http.Request{Method: method, URL: &url.URL{Path: path}, Header: http.Header{}}
+	_, registered := mx.stdmux.Handler(r)
+	rt := mx.base().lookup(registered)
+	if rt == nil {
+		return "", nil
+	}
+
+	// ServeMux also reports the pattern it would redirect to.
+	params, ok := matchPattern(rt.pattern, path)
+	if !ok {
+		return "", nil
+	}
+	if rt.subroutes == nil {
+		return rt.pattern, params
+	}
+
+	subPattern, subParams := rt.subroutes.Find(method, stripToLastSlash(path, len(wildcards(rt.pattern))))
+	if subPattern == "" {
+		return "", nil
+	}
+	for k, v := range subParams {
+		params[k] = v
+	}
+	return joinPatterns(rt.pattern, subPattern), params
+}
+
+// AllowedMethods returns the sorted methods of the routes matching the
+// host and path of the request along mounted subrouters, ["*"] when a route
+// registered for all methods matches, or nil when no route matches.
+func (mx *Mux) AllowedMethods(r *http.Request) []string {
+	base := mx.base()
+	if len(base.hosts) > 0 {
+		if hr, _ := base.matchHost(r.Host); hr != nil {
+			if methods := hr.mux.AllowedMethods(r); methods != nil {
+				return methods
+			}
+		}
+	}
+
+	// Probe with a method no route is registered for.
+	probe := &http.Request{Method: "STDCHI-PROBE", Host: r.Host, URL: &url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath}, Header: http.Header{}}
+	h, registered := mx.stdmux.Handler(probe)
+	if registered == "" {
+		rec := &fallbackRecorder{header: http.Header{}}
+		h.ServeHTTP(rec, probe)
+		if rec.status != http.StatusMethodNotAllowed {
+			return nil
+		}
+		// ServeMux doesn't see the constraints of the routes.
+		var methods []string
+		for _, m := range strings.Split(rec.header.Get("Allow"), ", ") {
+			probe.Method = m
+			if _, registered := mx.stdmux.Handler(probe); base.matchRoute(registered, probe.URL) != nil {
+				methods = append(methods, m)
+			}
+		}
+		return methods
+	}
+
+	rt := base.matchRoute(registered, r.URL)
+	if rt == nil {
+		return nil
+	}
+	if rt.subroutes == nil {
+		return []string{"*"}
+	}
+	sub, ok := rt.subroutes.(interface {
+		AllowedMethods(r *http.Request) []string
+	})
+	if !ok {
+		return []string{"*"}
+	}
+	n := len(wildcards(rt.pattern))
+	r2 := *r
+	r2.URL = &url.URL{Path: stripToLastSlash(r.URL.Path, n), RawPath: stripToLastSlash(r.URL.RawPath, n)}
+	return sub.AllowedMethods(&r2)
+}
+
+// matchRoute returns the route of the http.ServeMux pattern `registered`
+// if it matches the path of `u` with its constraints. ServeMux also
+// reports the pattern it would redirect to, which doesn't match.
+func (mx *Mux) matchRoute(registered string, u *url.URL) *route {
+	rt := mx.lookup(registered)
+	if rt == nil {
+		return nil
+	}
+	if _, ok := matchURL(rt.pattern, u); !ok {
+		return nil
+	}
+	return rt
+}
+
+// lookup returns the route registered with http.ServeMux as `registered`.
+func (mx *Mux) lookup(registered string) *route {
+	method, pattern, ok := strings.Cut(registered, " ")
+	if !ok {
+		method, pattern = "", registered
+	}
+	for i := len(mx.routes) - 1; i >= 0; i-- {
+		rt := mx.routes[i]
+		if std, _, _ := stdPattern(rt.pattern); std != pattern {
+			continue
+		}
+		if rt.method == method {
+			return rt
+		}
+	}
+	return nil
+}
+
+// NotFound sets a custom http.HandlerFunc for routing paths that could
+// not be found. The default 404 handler writes a problem details object,
+// or answers like `http.NotFound` clients that don't accept JSON.
+//
+// The handler runs after the Mux middleware stack and is inherited by
+// subrouters attached with Route or Mount that don't set their own.
+func (mx *Mux) NotFound(handlerFn http.HandlerFunc) {
+	m, hFn := mx.fallbackOwner(handlerFn)
+	m.notFoundHandler = hFn
+}
+
+// MethodNotAllowed sets a custom http.HandlerFunc for routing paths where the
+// method is unresolved. The default handler writes a problem details object,
+// or answers with a plain text 405 clients that don't accept JSON.
+//
+// The Allow header is already set on the response when the handler runs.
+// Like NotFound, it is inherited by subrouters.
+func (mx *Mux) MethodNotAllowed(handlerFn http.HandlerFunc) {
+	m, hFn := mx.fallbackOwner(handlerFn)
+	m.methodNotAllowedHandler = hFn
+}
+
+// AutoOptions makes the Mux answer OPTIONS requests for paths without an
+// OPTIONS route with 204 No Content and the Allow header listing the methods
+// registered for the path, including custom methods. The Allow header of
+// 405 responses then lists OPTIONS as well.
+//
+// A non-nil `handlerFn` is called instead of the default responder to
+// customise the response, with the Allow header already set. Like NotFound,
+// it runs after the Mux middleware stack and is inherited by subrouters.
+func (mx *Mux) AutoOptions(handlerFn http.HandlerFunc) {
+	if handlerFn == nil {
+		handlerFn = optionsHandler
+	}
+	m, hFn := mx.fallbackOwner(handlerFn)
+	m.optionsHandler = hFn
+}
+
+// NotFoundHandler returns the default Mux 404 responder whenever a route
+// cannot be found.
+func (mx *Mux) NotFoundHandler() http.HandlerFunc {
+	if h := mx.customNotFound(); h != nil {
+		return h
+	}
+	return notFoundHandler
+}
+
+// MethodNotAllowedHandler returns the default Mux 405 responder whenever
+// a method cannot be resolved for a route.
+func (mx *Mux) MethodNotAllowedHandler() http.HandlerFunc {
+	if h := mx.customMethodNotAllowed(); h != nil {
+		return h
+	}
+	return methodNotAllowedHandler
+}
+
+// base returns the Mux owning the routing tree shared by inline-Muxes.
+func (mx *Mux) base() *Mux {
+	m := mx
+	for m.inline && m.parent != nil {
+		m = m.parent
+	}
+	return m
+}
+
+// inlineMiddlewares returns the middlewares an inline-Mux adds on top of
+// the middleware stack of its base Mux.
+func (mx *Mux) inlineMiddlewares() Middlewares {
+	if n := len(mx.base().middlewares); n < len(mx.middlewares) {
+		return mx.middlewares[n:]
+	}
+	return nil
+}
+
+// fallbackOwner returns the Mux that owns the fallback handlers for mx.
+// Inline-Muxes share the routing tree of their parent, so their handlers
+// are set on the base Mux wrapped with the inline middlewares.
+func (mx *Mux) fallbackOwner(handlerFn http.HandlerFunc) (*Mux, http.HandlerFunc) {
+	if mws := mx.inlineMiddlewares(); len(mws) > 0 {
+		handlerFn = mws.HandlerFunc(handlerFn).ServeHTTP
+	}
+	return mx.base(), handlerFn
+}
+
+// customNotFound returns the closest custom 404 handler set on the Mux
+// or on one of its parents, or nil.
+func (mx *Mux) customNotFound() http.HandlerFunc {
+	for m := mx; m != nil; m = m.parent {
+		if m.notFoundHandler != nil {
+			return m.notFoundHandler
+		}
+	}
+	return nil
+}
+
+// customMethodNotAllowed returns the closest custom 405 handler set on
+// the Mux or on one of its parents, or nil.
+func (mx *Mux) customMethodNotAllowed() http.HandlerFunc {
+	for m := mx; m != nil; m = m.parent {
+		if m.methodNotAllowedHandler != nil {
+			return m.methodNotAllowedHandler
+		}
+	}
+	return nil
+}
+
+// autoOptions returns the closest OPTIONS responder set on the Mux or on
+// one of its parents with AutoOptions, or nil.
+func (mx *Mux) autoOptions() http.HandlerFunc {
+	for m := mx; m != nil; m = m.parent {
+		if m.optionsHandler != nil {
+			return m.optionsHandler
+		}
+	}
+	return nil
+}
+
+// optionsHandler is the default AutoOptions responder.
+func optionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// methodNotAllowedHandler is a helper function to respond with a 405,
+// method not allowed, as a problem details object.
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	WriteProblem(w, r, NewProblem(http.StatusMethodNotAllowed, ""))
+}
+
 // handle registers a http.Handler in the routing tree for a particular http method
-// and routing pattern.
-func (mx *Mux) handle(method methodTyp, pattern string, handler http.Handler) {
+// and routing pattern. It returns nil when the registration failed while
+// collecting errors with Register.
+//
+// An empty `method` matches all methods.
+func (mx *Mux) handle(method, pattern string, handler http.Handler) *route {
+	if host, path, ok := splitHostPattern(pattern); ok {
+		return mx.hostRouter(host).handle(method, path, handler)
+	}
 	if len(pattern) == 0 || pattern[0] != '/' {
-		panic(fmt.Sprintf("stdchi: routing pattern must begin with '/' in '%s'", pattern))
+		mx.fail(method, pattern,
+			fmt.Errorf("stdchi: routing pattern must begin with '/' in '%s'", pattern))
+		return nil
 	}
 
-	if method&mALL == mALL {
-		mx.stdmux.Handle(pattern, mx.mwsHandler(pattern, handler))
-	} else {
-		for k, v := range methodMap {
-			if method&v == v {
-				mx.stdmux.Handle(fmt.Sprintf("%s %s", k, pattern), mx.mwsHandler(pattern, handler))
+	base := mx.base()
+	if mx.name != "" {
+		for _, rt := range base.routes {
+			if rt.name == mx.name {
+				mx.fail(method, pattern,
+					fmt.Errorf("stdchi: route name '%s' is already in use by '%s'", mx.name, rt.pattern))
+				return nil
 			}
 		}
 	}
+
+	std, cons, err := stdPattern(pattern)
+	if err != nil {
+		mx.fail(method, pattern, err)
+		return nil
+	}
+
+	if !mx.stdHandle(method, pattern, std, mx.mwsHandler(pattern, cons, handler)) {
+		return nil
+	}
+
+	rt := &route{method: method, pattern: pattern, handler: handler, mux: mx, name: mx.name, meta: mx.meta}
+	base.routes = append(base.routes, rt)
+	return rt
 }
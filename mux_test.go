@@ -3,6 +3,8 @@ package stdchi
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -269,6 +272,63 @@ func TestMuxMounts(t *testing.T) {
 	}
 }
 
+func TestMuxRoutePattern(t *testing.T) {
+	var patterns []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RoutePattern(r.Context())))
+	}
+
+	r := NewRouter()
+	r.Get("/{hash}", h)
+	r.Route("/{hash}/share", func(r Router) {
+		r.Get("/{$}", h)
+		r.Get("/{network}", h)
+	})
+
+	m := NewRouter()
+	m.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			patterns = append(patterns, RoutePattern(r.Context()))
+		})
+	})
+	m.Mount("/sharing", r)
+
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	if _, body := testRequest(t, ts, "GET", "/sharing/aBc", nil); body != "/sharing/{hash}" {
+		t.Fatalf(body)
+	}
+	if _, body := testRequest(t, ts, "GET", "/sharing/aBc/share/", nil); body != "/sharing/{hash}/share/{$}" {
+		t.Fatalf(body)
+	}
+	if _, body := testRequest(t, ts, "GET", "/sharing/aBc/share/twitter", nil); body != "/sharing/{hash}/share/{network}" {
+		t.Fatalf(body)
+	}
+
+	expected := []string{"/sharing/{hash}", "/sharing/{hash}/share/{$}", "/sharing/{hash}/share/{network}"}
+	if fmt.Sprint(patterns) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, patterns)
+	}
+
+	// A request dispatched again from a mounted handler starts a new routing.
+	root := NewRouter()
+	root.Get("/home", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RoutePattern(r.Context()) + " " + fmt.Sprint(PathValues(r))))
+	})
+	root.Route("/api/{ver}", func(r Router) {
+		r.Get("/go", func(w http.ResponseWriter, r *http.Request) {
+			req := r.WithContext(context.WithValue(r.Context(), ctxKey{"k"}, "v"))
+			req.URL.Path = "/home"
+			root.ServeHTTP(w, req)
+		})
+	})
+	if _, body := testHandler(t, root, "GET", "/api/v1/go", nil); body != "/home map[]" {
+		t.Fatalf(body)
+	}
+}
+
 func TestMuxPlain(t *testing.T) {
 	r := NewRouter()
 	r.Get("/hi", func(w http.ResponseWriter, r *http.Request) {
@@ -400,6 +460,109 @@ func TestMuxNestedNotFound(t *testing.T) {
 	}
 }
 
+func TestMuxNestedNotFoundCustom(t *testing.T) {
+	r := NewRouter()
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), ctxKey{"mw"}, "mw"))
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	r.Get("/hi", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("bye"))
+	})
+
+	sr1 := NewRouter()
+	sr1.Get("/sub", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("sub"))
+	})
+	sr1.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte("sub nothing here"))
+	})
+
+	sr2 := NewRouter()
+	sr2.Get("/sub", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("sub2"))
+	})
+
+	r.Mount("/admin1", sr1)
+	r.Mount("/admin2", sr2)
+	r.Route("/admin3", func(r Router) {
+		r.Get("/sub", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("sub3"))
+		})
+	})
+
+	// Set after mounting, subrouters still inherit it.
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte("root 404 " + r.Context().Value(ctxKey{"mw"}).(string)))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	if _, body := testRequest(t, ts, "GET", "/hi", nil); body != "bye" {
+		t.Fatalf(body)
+	}
+	if re, body := testRequest(t, ts, "GET", "/nothing-here", nil); re.StatusCode != 404 || body != "root 404 mw" {
+		t.Fatalf(body)
+	}
+	if re, body := testRequest(t, ts, "GET", "/admin1/nope", nil); re.StatusCode != 404 || body != "sub nothing here" {
+		t.Fatalf(body)
+	}
+	if re, body := testRequest(t, ts, "GET", "/admin2/nope", nil); re.StatusCode != 404 || body != "root 404 mw" {
+		t.Fatalf(body)
+	}
+	if re, body := testRequest(t, ts, "GET", "/admin3/nope", nil); re.StatusCode != 404 || body != "root 404 mw" {
+		t.Fatalf(body)
+	}
+}
+
+func TestMuxMethodNotAllowedCustom(t *testing.T) {
+	r := NewRouter()
+	r.Get("/hi", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hi, get"))
+	})
+	r.Route("/sub", func(r Router) {
+		r.Post("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("sub, post"))
+		})
+	})
+	r.Group(func(r Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Group", "yes")
+				next.ServeHTTP(w, r)
+			})
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(405)
+			w.Write([]byte("custom 405 allow:" + w.Header().Get("Allow")))
+		})
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, body := testRequest(t, ts, "PUT", "/hi", nil)
+	if resp.StatusCode != 405 || body != "custom 405 allow:GET, HEAD" {
+		t.Fatalf("%d %s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Allow") != "GET, HEAD" || resp.Header.Get("X-Group") != "yes" {
+		t.Fatalf("unexpected headers: %v", resp.Header)
+	}
+	if resp, body := testRequest(t, ts, "GET", "/sub/1", nil); resp.StatusCode != 405 || body != "custom 405 allow:POST" {
+		t.Fatalf("%d %s", resp.StatusCode, body)
+	}
+	if resp, body := testRequest(t, ts, "GET", "/nope", nil); resp.StatusCode != 404 || body != "404 page not found\n" {
+		t.Fatalf("%d %s", resp.StatusCode, body)
+	}
+}
+
 func TestMethodNotAllowed(t *testing.T) {
 	r := NewRouter()
 
@@ -438,6 +601,66 @@ func TestMethodNotAllowed(t *testing.T) {
 	})
 }
 
+func TestMuxAutoOptions(t *testing.T) {
+	RegisterMethod("PROPFIND")
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}
+
+	r := NewRouter()
+	r.Get("/hi", h)
+	r.MethodFunc("PROPFIND", "/hi", h)
+	r.Options("/own", h)
+	r.Route("/sub", func(r Router) {
+		r.Post("/{id}", h)
+		r.Delete("/{id}", h)
+	})
+	r.AutoOptions(nil)
+
+	resp, body := testHandler(t, r, "OPTIONS", "/hi", nil)
+	if resp.StatusCode != 204 || body != "" || resp.Header.Get("Allow") != "GET, HEAD, OPTIONS, PROPFIND" {
+		t.Fatalf("%d %q %v", resp.StatusCode, body, resp.Header)
+	}
+	resp, _ = testHandler(t, r, "PUT", "/hi", nil)
+	if resp.StatusCode != 405 || resp.Header.Get("Allow") != "GET, HEAD, OPTIONS, PROPFIND" {
+		t.Fatalf("%d %v", resp.StatusCode, resp.Header)
+	}
+	if _, body := testHandler(t, r, "OPTIONS", "/own", nil); body != "OPTIONS" {
+		t.Fatalf(body)
+	}
+	resp, _ = testHandler(t, r, "OPTIONS", "/sub/1", nil)
+	if resp.StatusCode != 204 || resp.Header.Get("Allow") != "DELETE, OPTIONS, POST" {
+		t.Fatalf("%d %v", resp.StatusCode, resp.Header)
+	}
+	if resp, _ := testHandler(t, r, "OPTIONS", "/nope", nil); resp.StatusCode != 404 {
+		t.Fatalf("%d", resp.StatusCode)
+	}
+
+	r.AutoOptions(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.WriteHeader(200)
+		w.Write([]byte(w.Header().Get("Allow")))
+	})
+	resp, body = testHandler(t, r, "OPTIONS", "/sub/1", nil)
+	if resp.StatusCode != 200 || body != "DELETE, OPTIONS, POST" || resp.Header.Get("Cache-Control") != "max-age=60" {
+		t.Fatalf("%d %q %v", resp.StatusCode, body, resp.Header)
+	}
+
+	// Fallback handlers don't make matched requests routed twice.
+	r = NewRouter()
+	r.Route("/sub", func(r Router) {
+		r.Get("/{id}", h)
+	})
+	allocs := routeAllocs(r, "/sub/1", "")
+	r.NotFound(http.NotFound)
+	r.MethodNotAllowed(h)
+	r.AutoOptions(nil)
+	if got := routeAllocs(r, "/sub/1", ""); got != allocs {
+		t.Fatalf("%v allocs with fallback handlers, want %v", got, allocs)
+	}
+}
+
 func TestMuxNestedMethodNotAllowed(t *testing.T) {
 	r := NewRouter()
 	r.Get("/root", func(w http.ResponseWriter, r *http.Request) {
@@ -805,7 +1028,7 @@ func TestMuxMiddlewareStack(t *testing.T) {
 	testRequest(t, ts, "GET", "/", nil)
 	var body string
 	_, body = testRequest(t, ts, "GET", "/", nil)
-	if body != "inits:3 reqs:3 ctxValue:3" {
+	if body != "inits:1 reqs:3 ctxValue:3" {
 		t.Fatalf("got: '%s'", body)
 	}
 
@@ -1428,6 +1651,42 @@ func TestMiddlewarePanicOnLateUse(t *testing.T) {
 	r.Use(mw)
 }
 
+func TestMiddlewareLateUseInvalidatesChain(t *testing.T) {
+	var inits int
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			inits++
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	r := NewRouter()
+	r.Use(mw("a"))
+	r.Get("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("."))
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, body := testHandler(t, r, "GET", "/", nil); body != "a." {
+			t.Fatalf(body)
+		}
+	}
+	if inits != 1 {
+		t.Fatalf("expecting chain to be built once, got %d", inits)
+	}
+
+	r.Use(mw("b"))
+	if _, body := testHandler(t, r, "GET", "/", nil); body != "ab." {
+		t.Fatalf(body)
+	}
+	if inits != 3 {
+		t.Fatalf("expecting chain to be rebuilt after Use, got %d inits", inits)
+	}
+}
+
 func TestMountingExistingPath(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) {}
 
@@ -1443,6 +1702,79 @@ func TestMountingExistingPath(t *testing.T) {
 	r.Mount("/hi", http.HandlerFunc(handler))
 }
 
+func TestMuxRegister(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+
+	r := NewRouter()
+	r.Get("/users/{id}", h)
+
+	err := r.Register(func(r Router) {
+		r.Get("/hi", h)
+		r.Get("/users/{name}", h)
+		r.Method("NOPE", "/nope", http.HandlerFunc(h))
+		r.Handle("users", http.HandlerFunc(h))
+		r.Route("/sub", func(r Router) {
+			r.Get("/{$}", h)
+			r.With().Get("/{$}", h)
+		})
+		r.Mount("/nil", nil)
+	})
+
+	var rerr *RegistrationError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected *RegistrationError, got %v", err)
+	}
+	if len(rerr.Errors) != 5 {
+		t.Fatalf("expected 5 errors, got %d: %v", len(rerr.Errors), err)
+	}
+	if re := rerr.Errors[0]; re.Method != "GET" || re.Pattern != "/users/{name}" || re.Existing != "GET /users/{id}" {
+		t.Errorf("unexpected conflict error: %+v", re)
+	}
+	if re := rerr.Errors[3]; re.Pattern != "/{$}" || re.Existing != "GET /{$}" {
+		t.Errorf("unexpected subrouter conflict error: %+v", re)
+	}
+
+	// Valid routes of the batch are registered.
+	if _, body := testHandler(t, r, "GET", "/hi", nil); body != "ok" {
+		t.Fatalf(body)
+	}
+	if _, body := testHandler(t, r, "GET", "/sub/", nil); body != "ok" {
+		t.Fatalf(body)
+	}
+
+	if err := r.TryHandle("GET /users/{x}", http.HandlerFunc(h)); err == nil {
+		t.Error("expected TryHandle error")
+	}
+	if err := r.TryHandle("GET /ok", http.HandlerFunc(h)); err != nil {
+		t.Errorf("unexpected TryHandle error: %v", err)
+	}
+
+	// Host subrouters created before Register report to it too.
+	r.Get("api.example.com/a", h)
+	err = r.Register(func(r Router) {
+		r.Get("api.example.com/a", h)
+	})
+	if !errors.As(err, &rerr) || len(rerr.Errors) != 1 || rerr.Errors[0].Existing != "GET /a" {
+		t.Errorf("expected host conflict error, got %v", err)
+	}
+	if err := r.TryHandle("api.example.com/b", http.HandlerFunc(h)); err != nil {
+		t.Errorf("unexpected TryHandle error: %v", err)
+	}
+	if err := r.TryHandle("api.example.com/b", http.HandlerFunc(h)); err == nil {
+		t.Error("expected TryHandle error on host route")
+	}
+
+	// Errors panic again once Register returns.
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic()")
+		}
+	}()
+	r.Get("/users/{name}", h)
+}
+
 func TestMountingSimilarPattern(t *testing.T) {
 	r := NewRouter()
 	r.Get("/hi", func(w http.ResponseWriter, r *http.Request) {
@@ -1550,6 +1882,82 @@ func TestMuxRegexp(t *testing.T) {
 	}
 }
 
+func TestMuxRegexpConstraints(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(RoutePattern(r.Context()) + " " + r.PathValue("id") + r.PathValue("*")))
+	}
+
+	r := NewRouter()
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte("nope"))
+	})
+	r.Name("article").Get("/articles/{id:[0-9]+}", h)
+	r.Get("/users/{id:uuid}", h)
+	r.Route("/items/{id:int}", func(r Router) {
+		r.Get("/{$}", h)
+	})
+	r.Name("static").Get("/static/*", h)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/articles/123", 200, "/articles/{id:[0-9]+} 123"},
+		{"/articles/abc", 404, "nope"},
+		{"/users/6ba7b810-9dad-11d1-80b4-00c04fd430c8", 200, "/users/{id:uuid} 6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{"/users/42", 404, "nope"},
+		{"/items/-7/", 200, "/items/{id:int}/{$} -7"},
+		{"/items/x/", 404, "nope"},
+		{"/static/css/site.css", 200, "/static/* css/site.css"},
+	}
+	for _, tt := range tests {
+		resp, body := testHandler(t, r, "GET", tt.path, nil)
+		if resp.StatusCode != tt.status || body != tt.body {
+			t.Errorf("GET %s: expected %d %q, got %d %q", tt.path, tt.status, tt.body, resp.StatusCode, body)
+		}
+	}
+
+	if pattern, _ := r.Find("GET", "/articles/abc"); pattern != "" {
+		t.Errorf("expected no match, got %s", pattern)
+	}
+	if pattern, params := r.Find("GET", "/items/5/"); pattern != "/items/{id:int}/{$}" || params["id"] != "5" {
+		t.Errorf("unexpected Find result: %s %v", pattern, params)
+	}
+	if _, err := r.URL("article", "id", "x"); err == nil {
+		t.Error("expected URL error for a value not matching its constraint")
+	}
+	if u, err := r.URL("static", "*", "css/my site.css"); err != nil || u != "/static/css/my%20site.css" {
+		t.Errorf("unexpected URL: %s %v", u, err)
+	}
+	if _, err := r.URL("static"); err == nil {
+		t.Error("expected URL error for a missing '*' parameter")
+	}
+	if err := r.TryHandle("/bad/{id:[0-9}", http.HandlerFunc(h)); err == nil {
+		t.Error("expected error for an invalid regexp")
+	}
+
+	// Constrained siblings conflict with a stdchi error.
+	err := r.TryHandle("GET /articles/{slug:alpha}", http.HandlerFunc(h))
+	var rerr *RegistrationError
+	if !errors.As(err, &rerr) || rerr.Errors[0].Existing != "GET /articles/{id:[0-9]+}" ||
+		!strings.HasPrefix(err.Error(), "stdchi: 1 invalid route registrations:\n\tstdchi: routing pattern '/articles/{slug:alpha}' conflicts with '/articles/{id:[0-9]+}'") {
+		t.Errorf("unexpected conflict error: %v", err)
+	}
+	// Conflicts report the pattern of the route, not the http.ServeMux one.
+	err = r.TryHandle("GET /static/*", http.HandlerFunc(h))
+	if !errors.As(err, &rerr) || rerr.Errors[0].Existing != "GET /static/*" {
+		t.Errorf("unexpected conflict error: %v", err)
+	}
+	defer func() {
+		if v := recover(); v == nil || !strings.HasPrefix(fmt.Sprint(v), "stdchi: routing pattern '/users/{name:alpha}'") {
+			t.Errorf("unexpected panic: %v", v)
+		}
+	}()
+	r.Get("/users/{name:alpha}", h)
+}
+
 func TestMuxSubrouterWildcardParam(t *testing.T) {
 	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "param:%v *:%v", r.PathValue("param"), r.PathValue("tail"))
@@ -1582,6 +1990,56 @@ func TestMuxSubrouterWildcardParam(t *testing.T) {
 	}
 }
 
+func TestPathValues(t *testing.T) {
+	var before, after map[string]string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		values := PathValues(r)
+		w.Write([]byte(fmt.Sprintf("%v %s %s", values, URLParam(r, "hash"), URLParamFromCtx(r.Context(), "network"))))
+	}
+
+	sr := NewRouter()
+	sr.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			before = PathValues(r)
+			next.ServeHTTP(w, r)
+		})
+	})
+	sr.Get("/share/{network}", h)
+
+	r := NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			after = PathValues(r)
+		})
+	})
+	r.Host("{tenant}.example.com", func(r Router) {
+		r.Mount("/sharing/{hash}", sr)
+	})
+
+	r.Mount("/sharing/{hash}", sr)
+
+	_, body := testHandler(t, r, "GET", "http://acme.example.com/sharing/aBc/share/twitter", nil)
+	if body != "map[hash:aBc network:twitter tenant:acme] aBc twitter" {
+		t.Fatalf(body)
+	}
+	expected := "map[hash:aBc network:twitter tenant:acme]"
+	if fmt.Sprint(before) != expected {
+		t.Fatalf("expected %s in subrouter middleware, got %v", expected, before)
+	}
+	if fmt.Sprint(after) != expected {
+		t.Fatalf("expected %s in root middleware, got %v", expected, after)
+	}
+
+	_, body = testHandler(t, r, "GET", "/sharing/xYz/share/email", nil)
+	if body != "map[hash:xYz network:email] xYz email" {
+		t.Fatalf(body)
+	}
+	if expected := "map[hash:xYz network:email]"; fmt.Sprint(after) != expected {
+		t.Fatalf("expected %s in root middleware, got %v", expected, after)
+	}
+}
+
 func TestMuxContextIsThreadSafe(t *testing.T) {
 	router := NewRouter()
 	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
@@ -1680,6 +2138,56 @@ func TestCustomHTTPMethod(t *testing.T) {
 	}
 }
 
+func TestMuxRegisterMethod(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}
+
+	r := NewRouter()
+	r.Get("/hi", h)
+	r.Route("/dav", func(r Router) {
+		r.RegisterMethod("propfind", "MKCOL")
+		r.MethodFunc("PROPFIND", "/{name}", h)
+		r.With(func(next http.Handler) http.Handler { return next }).MethodFunc("MKCOL", "/{name}", h)
+		r.Route("/sub", func(r Router) {
+			r.MethodFunc("PROPFIND", "/", h)
+		})
+	})
+
+	// custom methods are not limited in number
+	for i := 0; i < 100; i++ {
+		m := fmt.Sprintf("VERB%d", i)
+		r.RegisterMethod(m)
+		r.MethodFunc(m, "/verbs/"+m, h)
+	}
+
+	err := r.Register(func(r Router) {
+		r.MethodFunc("MKCOL", "/other", h)
+	})
+	if err == nil {
+		t.Fatal("expecting MKCOL to be unsupported outside of /dav")
+	}
+	if NewRouter().supportsMethod("MKCOL") {
+		t.Fatal("expecting MKCOL to be registered on a single router")
+	}
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	if _, body := testRequest(t, ts, "PROPFIND", "/dav/file", nil); body != "PROPFIND" {
+		t.Fatalf(body)
+	}
+	if _, body := testRequest(t, ts, "MKCOL", "/dav/dir", nil); body != "MKCOL" {
+		t.Fatalf(body)
+	}
+	if _, body := testRequest(t, ts, "PROPFIND", "/dav/sub/", nil); body != "PROPFIND" {
+		t.Fatalf(body)
+	}
+	if _, body := testRequest(t, ts, "VERB99", "/verbs/VERB99", nil); body != "VERB99" {
+		t.Fatalf(body)
+	}
+}
+
 func TestMuxMatch(t *testing.T) {
 	r := NewRouter()
 	r.Get("/hi", func(w http.ResponseWriter, r *http.Request) {
@@ -1704,6 +2212,244 @@ func TestMuxMatch(t *testing.T) {
 			w.Write([]byte("user:" + id))
 		})
 	})
+	r.Mount("/files", http.FileServer(http.Dir(".")))
+
+	tests := []struct {
+		method, path string
+		pattern      string
+		params       map[string]string
+	}{
+		{"GET", "/hi", "/hi", map[string]string{}},
+		{"HEAD", "/hi", "/hi", map[string]string{}},
+		{"POST", "/hi", "", nil},
+		{"GET", "/hi/", "", nil},
+		{"GET", "/articles/123", "/articles/{id}", map[string]string{"id": "123"}},
+		{"GET", "/articles/", "", nil},
+		{"HEAD", "/users/7", "/users/{id}", map[string]string{"id": "7"}},
+		{"DELETE", "/users/7", "", nil},
+		{"GET", "/files/README.md", "/files/", map[string]string{}},
+		{"GET", "/nothing", "", nil},
+	}
+	for _, tt := range tests {
+		pattern, params := r.Find(tt.method, tt.path)
+		if pattern != tt.pattern || fmt.Sprint(params) != fmt.Sprint(tt.params) {
+			t.Errorf("Find(%s, %s) = %q %v, expected %q %v", tt.method, tt.path, pattern, params, tt.pattern, tt.params)
+		}
+		if r.Match(tt.method, tt.path) != (tt.pattern != "") {
+			t.Errorf("Match(%s, %s) expected %v", tt.method, tt.path, tt.pattern != "")
+		}
+	}
+}
+
+func TestMuxHost(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("%s tenant:%s id:%s", RoutePattern(r.Context()), r.PathValue("tenant"), r.PathValue("id"))))
+	}
+
+	r := NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Root", "yes")
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Get("/users/{id}", h)
+	r.Host("api.example.com", func(r Router) {
+		r.Get("/users/{id}", h)
+	})
+	r.Host("{tenant}.example.com", func(r Router) {
+		r.Name("tenant-user").Get("/users/{id}", h)
+		r.Route("/v1", func(r Router) {
+			r.Get("/users/{id}", h)
+		})
+	})
+	r.Handle("GET api.example.com/admin/{id}", http.HandlerFunc(h))
+	r.Name("admin").Get("api.example.com/admins/{id}", h)
+	r.Get("intranet/users/{id}", h)
+	r.Get("/health", h)
+
+	tests := []struct {
+		url  string
+		body string
+	}{
+		{"http://example.com/users/1", "/users/{id} tenant: id:1"},
+		{"http://api.example.com/users/2", "api.example.com/users/{id} tenant: id:2"},
+		{"http://API.example.com:8080/admin/3", "api.example.com/admin/{id} tenant: id:3"},
+		{"http://acme.example.com/users/4", "{tenant}.example.com/users/{id} tenant:acme id:4"},
+		{"http://acme.example.com/v1/users/5", "{tenant}.example.com/v1/users/{id} tenant:acme id:5"},
+		{"http://acme.example.com/nope", "404 page not found\n"},
+		{"http://api.example.com/health", "/health tenant: id:"},
+		{"http://intranet/users/6", "intranet/users/{id} tenant: id:6"},
+	}
+	for _, tt := range tests {
+		resp, body := testHandler(t, r, "GET", tt.url, nil)
+		if body != tt.body {
+			t.Errorf("GET %s: expected %q, got %q", tt.url, tt.body, body)
+		}
+		if resp.Header.Get("X-Root") != "yes" && resp.StatusCode == 200 {
+			t.Errorf("GET %s: expected root middleware to run", tt.url)
+		}
+	}
+
+	if pattern, params := r.Find("GET", "acme.example.com/v1/users/5"); pattern != "{tenant}.example.com/v1/users/{id}" ||
+		params["tenant"] != "acme" || params["id"] != "5" {
+		t.Errorf("unexpected Find result: %s %v", pattern, params)
+	}
+	if pattern, _ := r.Find("GET", "api.example.com/health"); pattern != "/health" {
+		t.Errorf("unexpected Find result: %s", pattern)
+	}
+	if u, err := r.URL("tenant-user", "tenant", "acme", "id", "7"); err != nil || u != "//acme.example.com/users/7" {
+		t.Errorf("unexpected URL: %s %v", u, err)
+	}
+	if u, err := r.URL("admin", "id", "8"); err != nil || u != "//api.example.com/admins/8" {
+		t.Errorf("unexpected URL: %s %v", u, err)
+	}
+
+	var routes []string
+	Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+route)
+		return nil
+	})
+	expected := []string{
+		"GET /users/{id}",
+		"GET /health",
+		"GET api.example.com/users/{id}",
+		"GET api.example.com/admin/{id}",
+		"GET api.example.com/admins/{id}",
+		"GET intranet/users/{id}",
+		"GET {tenant}.example.com/users/{id}",
+		"GET {tenant}.example.com/v1/users/{id}",
+	}
+	if fmt.Sprint(routes) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, routes)
+	}
+}
+
+func TestMuxRoutes(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	mw := func(next http.Handler) http.Handler { return next }
+
+	r := NewRouter()
+	r.Use(mw)
+	r.Get("/hi", h)
+	r.Post("/hi", h)
+	r.With(mw).Handle("/any", http.HandlerFunc(h))
+
+	routes := r.Routes()
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+	if routes[0].Pattern != "/hi" || len(routes[0].Handlers) != 2 ||
+		routes[0].Handlers["GET"] == nil || routes[0].Handlers["POST"] == nil {
+		t.Fatalf("unexpected route: %+v", routes[0])
+	}
+	if routes[1].Pattern != "/any" || routes[1].Handlers["*"] == nil {
+		t.Fatalf("unexpected route: %+v", routes[1])
+	}
+	if ch, ok := routes[1].Handlers["*"].(*ChainHandler); !ok || len(ch.Middlewares) != 1 {
+		t.Fatalf("expecting inline middlewares on route: %+v", routes[1])
+	}
+}
+
+func TestWalker(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	mw := func(next http.Handler) http.Handler { return next }
+
+	r := NewRouter()
+	r.Use(mw)
+	r.Get("/{$}", h)
+	r.Route("/sharing/{hash}/share", func(r Router) {
+		r.Use(mw)
+		r.Get("/{$}", h)
+		r.With(mw).Get("/{network}", h)
+	})
+	sr := NewRouter()
+	sr.Delete("/{id}", h)
+	r.Mount("/users", sr)
+	ar := NewRouter()
+	ar.Get("/x", h)
+	r.With(mw).Mount("/admin", ar)
+
+	var got []string
+	err := Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		got = append(got, fmt.Sprintf("%s %s %d", method, route, len(middlewares)))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"GET /{$} 1",
+		"GET /sharing/{hash}/share/{$} 2",
+		"GET /sharing/{hash}/share/{network} 3",
+		"DELETE /users/{id} 1",
+		"GET /admin/x 2",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestMuxURL(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	r := NewRouter()
+	r.Name("index").Get("/{$}", h)
+	r.With(func(next http.Handler) http.Handler { return next }).Name("user").Get("/users/{id}", h)
+
+	var sub Router
+	r.Route("/sharing/{hash}", func(r Router) {
+		sub = r
+		r.Name("share").Get("/share/{network}", h)
+		r.Group(func(r Router) {
+			r.Name("files").Get("/files/{path...}", h)
+		})
+	})
+
+	tests := []struct {
+		name   string
+		params []string
+		url    string
+		err    bool
+	}{
+		{"index", nil, "/", false},
+		{"user", []string{"id", "42"}, "/users/42", false},
+		{"user", []string{"id", "a b/c"}, "/users/a%20b%2Fc", false},
+		{"share", []string{"hash", "aBc", "network", "twitter"}, "/sharing/aBc/share/twitter", false},
+		{"files", []string{"hash", "x", "path", "dir/my file.txt"}, "/sharing/x/files/dir/my%20file.txt", false},
+		{"user", nil, "", true},
+		{"user", []string{"id"}, "", true},
+		{"user", []string{"id", "1", "extra", "2"}, "", true},
+		{"share", []string{"network", "twitter"}, "", true},
+		{"nope", nil, "", true},
+	}
+	for _, tt := range tests {
+		for _, rr := range []Router{r, sub} {
+			u, err := rr.URL(tt.name, tt.params...)
+			if (err != nil) != tt.err || u != tt.url {
+				t.Errorf("URL(%s, %v) = %q, %v; expected %q", tt.name, tt.params, u, err, tt.url)
+			}
+		}
+	}
+
+	// Names are unique per router, a subrouter may reuse one.
+	admin := NewRouter()
+	admin.Name("user").Get("/users/{id}", h)
+	r.Mount("/admin", admin)
+	if _, err := r.URL("user", "id", "1"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("expected an ambiguous route name error, got %v", err)
+	}
+	if _, err := admin.URL("user", "id", "1"); err == nil {
+		t.Error("expected an ambiguous route name error from the subrouter")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic() on duplicate route name")
+		}
+	}()
+	r.Name("user").Get("/people/{id}", h)
 }
 
 func TestServerBaseContext(t *testing.T) {
@@ -1734,6 +2480,235 @@ func TestServerBaseContext(t *testing.T) {
 	}
 }
 
+type jsonUserReq struct {
+	Tenant string        `json:"-" path:"tenant"`
+	ID     int64         `json:"-" path:"id"`
+	Fields []string      `json:"-" query:"fields"`
+	Wait   time.Duration `json:"-" query:"wait"`
+	Name   string        `json:"name"`
+}
+
+func (req jsonUserReq) Validate() error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+type jsonUserResp struct {
+	Tenant string   `json:"tenant"`
+	ID     int64    `json:"id"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+	Wait   string   `json:"wait"`
+}
+
+func (jsonUserResp) StatusCode() int { return http.StatusCreated }
+
+func TestJSON(t *testing.T) {
+	users := NewRouter()
+	users.Put("/{id}", JSON(func(ctx context.Context, req *jsonUserReq) (jsonUserResp, error) {
+		if req.ID == 0 {
+			return jsonUserResp{}, &HTTPError{Status: http.StatusConflict, Message: "reserved"}
+		}
+		return jsonUserResp{Tenant: req.Tenant, ID: req.ID, Name: req.Name, Fields: req.Fields, Wait: req.Wait.String()}, nil
+	}))
+
+	r := NewRouter()
+	r.Mount("/{tenant}/users", users)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		resp   string
+	}{
+		{"/acme/users/7?fields=a&fields=b&wait=1s", `{"name":"bob"}`, 201,
+			`{"tenant":"acme","id":7,"name":"bob","fields":["a","b"],"wait":"1s"}` + "\n"},
+		{"/acme/users/0", `{"name":"bob"}`, 409,
+			`{"detail":"reserved","instance":"/acme/users/0","status":409,"title":"Conflict","type":"about:blank"}` + "\n"},
+		{"/acme/users/x", `{"name":"bob"}`, 400, ""},
+		{"/acme/users/7?wait=x", `{"name":"bob"}`, 400, ""},
+		{"/acme/users/7", `{"name":"bob","age":3}`, 400, ""},
+		{"/acme/users/7", `{"name":"bob"}{}`, 400, ""},
+		{"/acme/users/7", `{}`, 422,
+			`{"detail":"name is required","instance":"/acme/users/7","status":422,"title":"Unprocessable Entity","type":"about:blank"}` + "\n"},
+		{"/acme/users/7", `{"name":"` + strings.Repeat("a", int(MaxJSONBodySize)) + `"}`, 413, ""},
+	}
+	for _, tt := range tests {
+		resp, body := testRequest(t, ts, "PUT", tt.path, strings.NewReader(tt.body))
+		if resp.StatusCode != tt.status || (tt.resp != "" && body != tt.resp) {
+			t.Fatalf("%s: unexpected response %d %q", tt.path, resp.StatusCode, body)
+		}
+		ct := "application/json"
+		if tt.status >= 400 {
+			ct = "application/problem+json"
+		}
+		if resp.Header.Get("Content-Type") != ct {
+			t.Fatalf("%s: unexpected content type %q", tt.path, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	req, _ := http.NewRequest("PUT", ts.URL+"/acme/users/7", strings.NewReader(`{"name":"bob"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestMuxProblem(t *testing.T) {
+	api := NewRouter()
+	api.Get("/users/{id}", E(func(w http.ResponseWriter, r *http.Request) error {
+		return &Problem{
+			Type:       "https://example.com/probs/out-of-credit",
+			Title:      "You do not have enough credit.",
+			Status:     http.StatusForbidden,
+			Detail:     "Your current balance is 30, but that costs 50.",
+			Extensions: map[string]any{"balance": 30, "status": "ignored"},
+		}
+	}))
+	api.Get("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	r := NewRouter()
+	r.Mount("/api", api)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		accept string
+		status int
+		ctype  string
+		body   string
+	}{
+		{"GET", "/api/nope", "", 404, "text/plain; charset=utf-8", "404 page not found\n"},
+		{"GET", "/api/nope", "text/plain, application/json;q=0.5", 404, "text/plain; charset=utf-8", "404 page not found\n"},
+		{"GET", "/api/nope", "application/json", 404, "application/problem+json",
+			`{"instance":"/api/nope","status":404,"title":"Not Found","type":"about:blank"}` + "\n"},
+		{"GET", "/nope", "*/*", 404, "text/plain; charset=utf-8", "404 page not found\n"},
+		{"GET", "/nope", "text/html,application/xhtml+xml,*/*;q=0.8", 404, "text/plain; charset=utf-8", "404 page not found\n"},
+		{"GET", "/nope", "application/*", 404, "text/plain; charset=utf-8", "404 page not found\n"},
+		{"GET", "/nope", "application/json, */*", 404, "application/problem+json",
+			`{"instance":"/nope","status":404,"title":"Not Found","type":"about:blank"}` + "\n"},
+		{"POST", "/api/users/1", "application/problem+json", 405, "application/problem+json",
+			`{"instance":"/api/users/1","status":405,"title":"Method Not Allowed","type":"about:blank"}` + "\n"},
+		{"GET", "/api/users/1", "application/json", 403, "application/problem+json",
+			`{"balance":30,"detail":"Your current balance is 30, but that costs 50.","instance":"/api/users/1","status":403,` +
+				`"title":"You do not have enough credit.","type":"https://example.com/probs/out-of-credit"}` + "\n"},
+		{"GET", "/api/users/1", "text/html", 403, "text/plain; charset=utf-8", "Your current balance is 30, but that costs 50.\n"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || resp.Header.Get("Content-Type") != tt.ctype || string(body) != tt.body {
+			t.Fatalf("%s %s: unexpected response %d %q %q", tt.method, tt.path, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+		}
+		if tt.status == 405 && resp.Header.Get("Allow") == "" {
+			t.Fatalf("expecting the Allow header")
+		}
+	}
+
+	var p Problem
+	if err := json.Unmarshal([]byte(`{"type":"about:blank","status":404,"balance":30}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != 404 || p.Extensions["balance"] != float64(30) {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+
+	// Accepting JSON doesn't change the routing of matched requests.
+	if a, b := routeAllocs(r, "/api/ok", ""), routeAllocs(r, "/api/ok", "application/json"); a != b {
+		t.Fatalf("expected %v allocations with Accept, got %v", a, b)
+	}
+}
+
+func TestMuxMeta(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	r := NewRouter()
+	r.Get("/plain", h)
+	docs := r.Meta("docs")
+	docs.Get("/a", h)
+	docs.With(func(next http.Handler) http.Handler { return next }).Meta("more").Post("/a", h)
+	docs.Route("/sub", func(r Router) {
+		r.Get("/", h)
+	})
+
+	routes := r.Routes()
+	if len(routes) != 3 {
+		t.Fatalf("unexpected routes %v", routes)
+	}
+	if routes[0].Meta != nil {
+		t.Fatalf("unexpected metadata %v", routes[0].Meta)
+	}
+	if m := routes[1].Meta; fmt.Sprint(m["GET"]) != "[docs]" || fmt.Sprint(m["POST"]) != "[docs more]" {
+		t.Fatalf("unexpected metadata %v", m)
+	}
+	if m := routes[2].Meta; fmt.Sprint(m["*"]) != "[docs]" || routes[2].SubRoutes.Routes()[0].Meta != nil {
+		t.Fatalf("unexpected metadata %v", m)
+	}
+
+	r.Meta("host").Get("api.example.com/x", h)
+	routes = r.Routes()
+	if m := routes[3].SubRoutes.Routes()[0].Meta; fmt.Sprint(m["GET"]) != "[host]" {
+		t.Fatalf("unexpected host route metadata %v", m)
+	}
+}
+
+func TestMuxAllowedMethods(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	r := NewRouter()
+	r.Get("/users/{id}", h)
+	r.Put("/users/{id}", h)
+	r.Handle("/static/", http.HandlerFunc(h))
+	r.Route("/admin", func(r Router) {
+		r.Post("/jobs/{id}", h)
+		r.Delete("/jobs/{id}", h)
+	})
+	r.Get("/items/{id:int}", h)
+	r.Delete("/items/{id}", h)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users/1", "GET, HEAD, PUT"},
+		{"/users/a%2Fb", "GET, HEAD, PUT"},
+		{"/items/1", "DELETE, GET, HEAD"},
+		{"/items/x", "DELETE"},
+		{"/static/app.js", "*"},
+		{"/admin/jobs/1", "DELETE, POST"},
+		{"/admin/jobs/a%2Fb", "DELETE, POST"},
+		{"/users", ""},
+		{"/admin/jobs", ""},
+		{"/nothing", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("OPTIONS", tt.path, nil)
+		if got := strings.Join(r.AllowedMethods(req), ", "); got != tt.want {
+			t.Fatalf("%s: expecting %q, got %q", tt.path, tt.want, got)
+		}
+	}
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io.Reader) (*http.Response, string) {
 	req, err := http.NewRequest(method, ts.URL+path, body)
 	if err != nil {
@@ -1764,6 +2739,27 @@ func testHandler(t *testing.T, h http.Handler, method, path string, body io.Read
 	return w.Result(), w.Body.String()
 }
 
+// routeAllocs returns the allocations made to serve GET `path`,
+// discarding the response.
+func routeAllocs(h http.Handler, path, accept string) float64 {
+	req := httptest.NewRequest("GET", path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := &discardWriter{header: http.Header{}}
+	return testing.AllocsPerRun(100, func() {
+		h.ServeHTTP(w, req)
+	})
+}
+
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
 type ctxKey struct {
 	name string
 }
@@ -1823,3 +2819,65 @@ func BenchmarkMux(b *testing.B) {
 		})
 	}
 }
+
+func TestMuxErrorHandler(t *testing.T) {
+	errNotFound := errors.New("not found in db")
+	getUser := func(w http.ResponseWriter, r *http.Request) error {
+		if r.PathValue("id") != "1" {
+			return &HTTPError{Status: http.StatusNotFound, Message: "user not found", Err: errNotFound}
+		}
+		w.Write([]byte("user 1"))
+		return nil
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("secret details")
+	}
+	custom := func(prefix string) ErrorHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, err error) {
+			status, msg := ErrorStatus(err)
+			if !errors.Is(err, errNotFound) && status == http.StatusNotFound {
+				t.Error("expecting the cause to be wrapped")
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(prefix + msg))
+		}
+	}
+
+	r := NewRouter()
+	r.Get("/default/{id}", E(getUser))
+
+	api := NewRouter()
+	api.Get("/users/{id}", E(getUser))
+	api.Handle("/fail", HandlerFuncE(failing))
+	api.Group(func(r Router) {
+		r.ErrorHandler(custom("group: "))
+		r.Get("/group/fail", E(failing))
+	})
+	api.Route("/admin", func(r Router) {
+		r.Get("/fail", E(failing))
+	})
+	api.ErrorHandler(custom("api: "))
+	r.Mount("/api", api)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/default/1", 200, "user 1"},
+		{"/default/2", 404, "user not found\n"},
+		{"/api/users/2", 404, "api: user not found"},
+		{"/api/fail", 500, "api: Internal Server Error"},
+		{"/api/group/fail", 500, "group: Internal Server Error"},
+		{"/api/admin/fail", 500, "api: Internal Server Error"},
+	}
+	for _, tt := range tests {
+		resp, body := testRequest(t, ts, "GET", tt.path, nil)
+		if resp.StatusCode != tt.status || body != tt.body {
+			t.Fatalf("%s: unexpected response %d %q", tt.path, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+// Package openapi generates OpenAPI 3.1 documents from the routes of
+// a stdchi router.
+//
+// Operation details are attached to the routes with Router.Meta:
+//
+//	r.Meta(openapi.Op{
+//		Summary:   "Get a user",
+//		Tags:      []string{"users"},
+//		Request:   getUserRequest{},
+//		Responses: map[int]any{200: User{}, 404: nil},
+//	}).Get("/users/{id}", getUser)
+//
+//	r.Mount("/openapi", openapi.Handler(r, openapi.Info{Title: "API", Version: "1.0"}))
+//
+// The paths are converted from the stdchi patterns, `{name}`, `{name...}`
+// and `{name:regexp}` wildcards become path parameters. The fields of the
+// request type tagged `path:"name"` and `query:"name"`, as bound by
+// stdchi.JSON, give the types of the path and query parameters, the other
+// fields make the JSON request body. Schemas are derived from Go types by
+// reflection following the encoding/json rules, named struct types are
+// listed as components.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/covrom/stdchi"
+)
+
+// Op is the operation metadata attached to a route with Router.Meta.
+//
+// Attached to a Mount or Route, its Tags are added to all the operations
+// of the subrouter and Hidden hides them all.
+type Op struct {
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+
+	// Hidden excludes the operation from the document.
+	Hidden bool
+
+	// Request is a value of the request type, see the package doc.
+	Request any
+
+	// Responses are values of the JSON response body types by status
+	// code, nil for responses without body. The default is a 200 response
+	// without body.
+	Responses map[int]any
+}
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components *Components         `json:"components,omitempty"`
+}
+
+// Info is the metadata about the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a server hosting the API.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem lists the operations of a path by lowercase method.
+type PathItem map[string]*Operation
+
+// Operation is an API operation on a path.
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter of an operation.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody is the request body of an operation.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the content of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the reusable schemas.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema is a JSON Schema object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Generate returns the OpenAPI document of the routes of `r`, including
+// the routes of the subrouters attached with Mount and Route. Routes
+// registered for all methods and the routes of Host subrouters are
+// left out.
+func Generate(r stdchi.Routes, info Info) *Document {
+	g := &generator{
+		doc:     &Document{OpenAPI: "3.1.0", Info: info, Paths: map[string]PathItem{}},
+		schemas: newSchemas(),
+	}
+	g.walk(r, "", nil)
+	if len(g.schemas.components) > 0 {
+		g.doc.Components = &Components{Schemas: g.schemas.components}
+	}
+	return g.doc
+}
+
+// Handler returns a handler serving the OpenAPI document of the routes
+// of `r` as YAML for paths ending with `.yaml` or `.yml`, and as JSON
+// otherwise. The document is generated on the first request, so the
+// handler can be mounted on `r` itself.
+func Handler(r stdchi.Routes, info Info) http.Handler {
+	var (
+		once     sync.Once
+		jsonDoc  []byte
+		yamlDoc  []byte
+		genError error
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		once.Do(func() {
+			doc := Generate(r, info)
+			if jsonDoc, genError = json.MarshalIndent(doc, "", "  "); genError == nil {
+				yamlDoc, genError = toYAML(jsonDoc)
+			}
+		})
+		if genError != nil {
+			stdchi.HandleError(w, req, genError)
+			return
+		}
+		if strings.HasSuffix(req.URL.Path, ".yaml") || strings.HasSuffix(req.URL.Path, ".yml") {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(yamlDoc)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jsonDoc)
+	})
+}
+
+type generator struct {
+	doc     *Document
+	schemas *schemas
+}
+
+// walk adds the operations of the routes of `r` mounted on `prefix`.
+// The parents are the operation details of the mount points.
+func (g *generator) walk(r stdchi.Routes, prefix string, parents []Op) {
+	for _, rt := range r.Routes() {
+		if !strings.HasPrefix(rt.Pattern, "/") {
+			continue // Host subrouter
+		}
+		pattern := strings.TrimSuffix(prefix, "/") + rt.Pattern
+
+		if rt.SubRoutes != nil {
+			ops := parents
+			if op, ok := opOf(rt.Meta["*"]); ok {
+				if op.Hidden {
+					continue
+				}
+				ops = append(ops[:len(ops):len(ops)], op)
+			}
+			g.walk(rt.SubRoutes, pattern, ops)
+			continue
+		}
+
+		methods := make([]string, 0, len(rt.Handlers))
+		for method := range rt.Handlers {
+			if method != "*" {
+				methods = append(methods, method)
+			}
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			op, _ := opOf(rt.Meta[method])
+			if op.Hidden {
+				continue
+			}
+			path, params := convertPattern(pattern)
+			item := g.doc.Paths[path]
+			if item == nil {
+				item = PathItem{}
+				g.doc.Paths[path] = item
+			}
+			item[strings.ToLower(method)] = g.operation(op, parents, params)
+		}
+	}
+}
+
+// opOf returns the operation details among the metadata of a route.
+func opOf(meta []any) (Op, bool) {
+	var op Op
+	found := false
+	for _, m := range meta {
+		switch v := m.(type) {
+		case Op:
+			op, found = mergeOp(op, v), true
+		case *Op:
+			op, found = mergeOp(op, *v), true
+		}
+	}
+	return op, found
+}
+
+// mergeOp returns `op` overridden by the details set in `with`,
+// with the tags of both.
+func mergeOp(op, with Op) Op {
+	tags := append(op.Tags[:len(op.Tags):len(op.Tags)], with.Tags...)
+	if with.ID != "" {
+		op.ID = with.ID
+	}
+	if with.Summary != "" {
+		op.Summary = with.Summary
+	}
+	if with.Description != "" {
+		op.Description = with.Description
+	}
+	if with.Request != nil {
+		op.Request = with.Request
+	}
+	if with.Responses != nil {
+		op.Responses = with.Responses
+	}
+	op.Deprecated = op.Deprecated || with.Deprecated
+	op.Hidden = op.Hidden || with.Hidden
+	op.Tags = tags
+	return op
+}
+
+func (g *generator) operation(op Op, parents []Op, params []pathParam) *Operation {
+	o := &Operation{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Deprecated:  op.Deprecated,
+		Responses:   map[string]*Response{},
+	}
+	seen := map[string]bool{}
+	for _, p := range append(parents[:len(parents):len(parents)], op) {
+		for _, tag := range p.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				o.Tags = append(o.Tags, tag)
+			}
+		}
+	}
+
+	var req reflect.Type
+	if op.Request != nil {
+		req = typeOf(op.Request)
+	}
+	for _, p := range params {
+		param := &Parameter{Name: p.name, In: "path", Required: true, Schema: p.schema()}
+		if p.rest {
+			param.Description = "The rest of the path."
+		}
+		if f, ok := boundField(req, "path", p.name); ok {
+			param.Schema = g.schemas.param(f.Type)
+			param.Description = f.Tag.Get("doc")
+		}
+		o.Parameters = append(o.Parameters, param)
+	}
+	for _, f := range boundFields(req, "query") {
+		o.Parameters = append(o.Parameters, &Parameter{
+			Name:        f.Tag.Get("query"),
+			In:          "query",
+			Description: f.Tag.Get("doc"),
+			Schema:      g.schemas.param(f.Type),
+		})
+	}
+	if body := g.schemas.body(req); body != nil {
+		o.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: body}},
+		}
+	}
+
+	if len(op.Responses) == 0 {
+		o.Responses["200"] = &Response{Description: http.StatusText(http.StatusOK)}
+	}
+	for status, v := range op.Responses {
+		resp := &Response{Description: http.StatusText(status)}
+		if v != nil {
+			resp.Content = map[string]MediaType{"application/json": {Schema: g.schemas.schema(typeOf(v))}}
+		}
+		o.Responses[strconv.Itoa(status)] = resp
+	}
+	return o
+}
+
+// typeOf returns the type of a value, or the type itself for
+// a reflect.Type.
+func typeOf(v any) reflect.Type {
+	if t, ok := v.(reflect.Type); ok {
+		return t
+	}
+	return reflect.TypeOf(v)
+}
@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/covrom/stdchi"
+)
+
+type user struct {
+	ID       int64     `json:"id"`
+	Age      int       `json:"age,omitempty"`
+	Name     string    `json:"name" doc:"Full name"`
+	Email    *string   `json:"email,omitempty"`
+	Created  time.Time `json:"created"`
+	Friends  []*user   `json:"friends,omitempty"`
+	internal string
+}
+
+type updateUser struct {
+	ID      int64         `json:"-" path:"id" doc:"User ID"`
+	Fields  []string      `json:"-" query:"fields"`
+	Timeout time.Duration `json:"-" query:"timeout"`
+	Name    string        `json:"name"`
+}
+
+func testRouter() *stdchi.Mux {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+
+	users := stdchi.NewRouter()
+	users.Meta(Op{ID: "getUser", Summary: "Get a user", Responses: map[int]any{200: user{}, 404: nil}}).
+		Get("/{id:int}", h)
+	users.Meta(Op{ID: "updateUser", Request: updateUser{}, Responses: map[int]any{200: &user{}}}).
+		Put("/{id}", h)
+	users.Meta(Op{Hidden: true}).Delete("/{id}", h)
+
+	r := stdchi.NewRouter()
+	r.Get("/{$}", h)
+	r.Get("/files/{path...}", h)
+	r.Handle("/any", http.HandlerFunc(h))
+	r.Meta(Op{Tags: []string{"users"}}).Mount("/users", users)
+	r.Route("/internal", func(r stdchi.Router) {
+		r.Get("/stats", h)
+	})
+	r.Meta(Op{Hidden: true}).Route("/hidden", func(r stdchi.Router) {
+		r.Get("/", h)
+	})
+	r.Mount("/openapi", Handler(r, Info{Title: "Test", Version: "1.0"}))
+	return r
+}
+
+func TestGenerate(t *testing.T) {
+	doc := Generate(testRouter(), Info{Title: "Test", Version: "1.0"})
+
+	var paths []string
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	want := map[string][]string{
+		"/":               {"get"},
+		"/files/{path}":   {"get"},
+		"/users/{id}":     {"get", "put"},
+		"/internal/stats": {"get"},
+	}
+	if len(doc.Paths) != len(want) {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+	for p, methods := range want {
+		if len(doc.Paths[p]) != len(methods) {
+			t.Fatalf("unexpected operations for %s: %v", p, doc.Paths[p])
+		}
+		for _, m := range methods {
+			if doc.Paths[p][m] == nil {
+				t.Fatalf("missing %s %s", m, p)
+			}
+		}
+	}
+
+	get := doc.Paths["/users/{id}"]["get"]
+	if get.OperationID != "getUser" || len(get.Tags) != 1 || get.Tags[0] != "users" {
+		t.Fatalf("unexpected operation %+v", get)
+	}
+	if p := get.Parameters[0]; p.Name != "id" || p.In != "path" || !p.Required || p.Schema.Type != "integer" {
+		t.Fatalf("unexpected parameter %+v", p)
+	}
+	if get.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/user" || get.Responses["404"].Content != nil {
+		t.Fatalf("unexpected responses %+v", get.Responses)
+	}
+
+	put := doc.Paths["/users/{id}"]["put"]
+	if len(put.Parameters) != 3 || put.Parameters[0].Description != "User ID" || put.Parameters[0].Schema.Format != "int64" ||
+		put.Parameters[1].Name != "fields" || put.Parameters[1].In != "query" || put.Parameters[1].Schema.Type != "array" {
+		t.Fatalf("unexpected parameters %+v", put.Parameters)
+	}
+	if p := put.Parameters[2]; p.Name != "timeout" || p.Schema.Type != "string" || p.Schema.Format != "" {
+		t.Fatalf("unexpected duration parameter %+v", p)
+	}
+	body := put.RequestBody.Content["application/json"].Schema
+	if len(body.Properties) != 1 || body.Properties["name"] == nil {
+		t.Fatalf("unexpected body %+v", body)
+	}
+
+	if p := doc.Paths["/files/{path}"]["get"].Parameters[0]; p.Name != "path" || p.Description == "" {
+		t.Fatalf("unexpected parameter %+v", p)
+	}
+
+	us := doc.Components.Schemas["user"]
+	if strings.Join(us.Required, ",") != "id,name,created" || len(us.Properties) != 6 {
+		t.Fatalf("unexpected schema %+v", us)
+	}
+	if us.Properties["friends"].Items.Ref != "#/components/schemas/user" || us.Properties["created"].Format != "date-time" ||
+		us.Properties["name"].Description != "Full name" || us.Properties["age"].Format != "int64" {
+		t.Fatalf("unexpected properties %+v", us.Properties)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ts := httptest.NewServer(testRouter())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/openapi/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc Document
+	err = json.NewDecoder(resp.Body).Decode(&doc)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.1.0" || doc.Info.Title != "Test" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+
+	resp, err = http.Get(ts.URL + "/openapi/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	yaml := string(b)
+	for _, s := range []string{
+		"openapi: \"3.1.0\"\n",
+		"info:\n  title: \"Test\"\n  version: \"1.0\"\n",
+		"  \"/users/{id}\":\n    get:\n      operationId: \"getUser\"\n",
+		"      parameters:\n        - name: \"id\"\n          in: \"path\"\n          required: true\n",
+		"      tags:\n        - \"users\"\n",
+		"        \"404\":\n          description: \"Not Found\"\n",
+	} {
+		if !strings.Contains(yaml, s) {
+			t.Fatalf("expecting %q in:\n%s", s, yaml)
+		}
+	}
+}
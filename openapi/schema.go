@@ -0,0 +1,281 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/covrom/stdchi"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	rawMessageType      = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	invalidSchemaNameRe = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+// schemas derives the schemas of Go types, collecting the named struct
+// types as components.
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+// schema returns the schema of the JSON encoding of type `t`.
+func (s *schemas) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType, t.Kind() == reflect.Interface:
+		return &Schema{}
+	case t.Implements(jsonMarshalerType), reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType), reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: new(float64)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t, false)
+		}
+		return s.ref(t)
+	}
+	return &Schema{}
+}
+
+// param returns the schema of a path value or query parameter bound to
+// a field of type `t`. Values are parsed from strings like stdchi.JSON does,
+// so durations are strings such as `1s`.
+func (s *schemas) param(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		return &Schema{Type: "array", Items: s.param(t.Elem())}
+	}
+	return s.schema(t)
+}
+
+// ref returns a reference to the component schema of a named struct type.
+func (s *schemas) ref(t reflect.Type) *Schema {
+	name, ok := s.names[t]
+	if !ok {
+		base := invalidSchemaNameRe.ReplaceAllString(t.Name(), "_")
+		name = base
+		for i := 2; s.components[name] != nil; i++ {
+			name = base + strconv.Itoa(i)
+		}
+		s.names[t] = name
+		// Registered before it's built, for recursive types.
+		s.components[name] = &Schema{}
+		*s.components[name] = *s.object(t, false)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// object returns the schema of a struct type, leaving out the fields
+// bound to path values and query parameters when `skipBound` is set.
+func (s *schemas) object(t reflect.Type, skipBound bool) *Schema {
+	sc := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(sc, t, skipBound)
+	return sc
+}
+
+func (s *schemas) fields(sc *Schema, t reflect.Type, skipBound bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			s.fields(sc, ft, skipBound)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if skipBound && (hasTag(f, "path") || hasTag(f, "query")) {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := s.schema(f.Type)
+		if strings.Contains(","+opts+",", ",string,") {
+			fs = &Schema{Type: "string"}
+		}
+		if doc := f.Tag.Get("doc"); doc != "" {
+			if fs.Ref != "" {
+				// $ref siblings are allowed in OpenAPI 3.1.
+				fs = &Schema{Ref: fs.Ref}
+			}
+			fs.Description = doc
+		}
+		sc.Properties[name] = fs
+		if !strings.Contains(","+opts+",", ",omitempty,") && !strings.Contains(","+opts+",", ",omitzero,") && f.Type.Kind() != reflect.Pointer {
+			sc.Required = append(sc.Required, name)
+		}
+	}
+}
+
+// body returns the schema of the JSON request body of the request type
+// `t`, or nil when it has no body fields.
+func (s *schemas) body(t reflect.Type) *Schema {
+	if t == nil {
+		return nil
+	}
+	st := t
+	for st.Kind() == reflect.Pointer {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		return s.schema(t)
+	}
+	sc := s.object(st, true)
+	if len(sc.Properties) == 0 {
+		return nil
+	}
+	if len(boundFields(st, "path")) == 0 && len(boundFields(st, "query")) == 0 && st.Name() != "" {
+		return s.ref(st)
+	}
+	return sc
+}
+
+func hasTag(f reflect.StructField, key string) bool {
+	_, ok := f.Tag.Lookup(key)
+	return ok
+}
+
+// boundFields returns the fields of the request type `t` tagged with `key`,
+// `path` or `query`, including the promoted fields of embedded structs.
+func boundFields(t reflect.Type, key string) []reflect.StructField {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fs []reflect.StructField
+	for _, f := range reflect.VisibleFields(t) {
+		if f.IsExported() && !f.Anonymous && hasTag(f, key) {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// boundField returns the field of the request type `t` bound to
+// the `key` (path or query) value `name`.
+func boundField(t reflect.Type, key, name string) (reflect.StructField, bool) {
+	for _, f := range boundFields(t, key) {
+		if f.Tag.Get(key) == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// pathParam is a wildcard of a route pattern.
+type pathParam struct {
+	name string
+	expr string // regexp constraint
+	rest bool   // `{name...}` or trailing `*`
+}
+
+func (p pathParam) schema() *Schema {
+	switch p.expr {
+	case "":
+		return &Schema{Type: "string"}
+	case "int":
+		return &Schema{Type: "integer"}
+	case "uint":
+		return &Schema{Type: "integer", Minimum: new(float64)}
+	case "uuid":
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+	expr := stdchi.ConstraintExpr(p.expr)
+	if !strings.HasPrefix(expr, "^") {
+		expr = "^" + expr
+	}
+	if !strings.HasSuffix(expr, "$") {
+		expr += "$"
+	}
+	return &Schema{Type: "string", Pattern: expr}
+}
+
+// convertPattern converts a stdchi pattern to an OpenAPI path and
+// returns its wildcards.
+func convertPattern(pattern string) (string, []pathParam) {
+	pattern = strings.TrimSuffix(pattern, "{$}")
+	segs := strings.Split(pattern, "/")
+	var params []pathParam
+	for i, seg := range segs {
+		switch {
+		case seg == "*" && i == len(segs)-1:
+			params = append(params, pathParam{name: "*", rest: true})
+			segs[i] = "{*}"
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			p := pathParam{name: seg[1 : len(seg)-1]}
+			if name, expr, ok := strings.Cut(p.name, ":"); ok {
+				p.name, p.expr = name, expr
+			}
+			if strings.HasSuffix(p.name, "...") {
+				p.name, p.rest = strings.TrimSuffix(p.name, "..."), true
+			}
+			params = append(params, p)
+			segs[i] = "{" + p.name + "}"
+		}
+	}
+	return strings.Join(segs, "/"), params
+}
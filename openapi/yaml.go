@@ -0,0 +1,122 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// yamlNode is a decoded JSON value keeping the order of object members.
+type yamlNode struct {
+	scalar  string // encoded scalar, empty for objects and arrays
+	keys    []string
+	members []*yamlNode // object members or array items
+	array   bool
+}
+
+// toYAML converts a JSON document to block style YAML.
+func toYAML(doc []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	n, err := decodeNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeYAML(&buf, n, 0)
+	return buf.Bytes(), nil
+}
+
+func decodeNode(dec *json.Decoder) (*yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		n := &yamlNode{array: v == '['}
+		for dec.More() {
+			if !n.array {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			m, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.members = append(n.members, m)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case string:
+		b, _ := json.Marshal(v)
+		return &yamlNode{scalar: string(b)}, nil
+	case nil:
+		return &yamlNode{scalar: "null"}, nil
+	default:
+		return &yamlNode{scalar: fmt.Sprint(v)}, nil
+	}
+}
+
+func (n *yamlNode) inline() (string, bool) {
+	switch {
+	case n.scalar != "":
+		return n.scalar, true
+	case len(n.members) > 0:
+		return "", false
+	case n.array:
+		return "[]", true
+	default:
+		return "{}", true
+	}
+}
+
+func writeYAML(buf *bytes.Buffer, n *yamlNode, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for i, m := range n.members {
+		if n.array {
+			buf.WriteString(pad + "- ")
+		} else {
+			buf.WriteString(pad + yamlKey(n.keys[i]) + ":")
+		}
+		if s, ok := m.inline(); ok {
+			if !n.array {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(s + "\n")
+			continue
+		}
+		if n.array && !m.array {
+			// The first member of an object item follows the dash.
+			var item bytes.Buffer
+			writeYAML(&item, m, indent+1)
+			buf.Write(bytes.TrimPrefix(item.Bytes(), []byte(pad+"  ")))
+			continue
+		}
+		buf.WriteByte('\n')
+		writeYAML(buf, m, indent+1)
+	}
+}
+
+var plainKeyRe = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$.-]*$`)
+
+// yamlKey quotes the keys that could be read as non-strings or
+// contain special characters.
+func yamlKey(k string) string {
+	switch strings.ToLower(k) {
+	case "true", "false", "null", "yes", "no", "on", "off", "y", "n":
+	default:
+		if plainKeyRe.MatchString(k) {
+			return k
+		}
+	}
+	b, _ := json.Marshal(k)
+	return string(b)
+}
@@ -0,0 +1,252 @@
+package stdchi
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Problem is an RFC 9457 problem details object, written as
+// `application/problem+json`. It is an error, so handlers may return it.
+type Problem struct {
+	// Type is a URI reference identifying the problem type,
+	// "about:blank" when empty.
+	Type string
+
+	// Title is a short summary of the problem type, the status text
+	// when empty.
+	Title string
+
+	// Status is the HTTP status code, 500 (Internal Server Error) when zero.
+	Status int
+
+	// Detail explains this occurrence of the problem.
+	Detail string
+
+	// Instance is a URI reference identifying this occurrence of the
+	// problem, the request path when empty.
+	Instance string
+
+	// Extensions are additional members of the problem object. They don't
+	// override the members above.
+	Extensions map[string]any
+}
+
+// NewProblem returns a Problem for `status` with the status text as title.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Status: status, Title: http.StatusText(status), Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.title() + ": " + p.Detail
+	}
+	return p.title()
+}
+
+// StatusCode returns the HTTP status of the problem.
+func (p *Problem) StatusCode() int {
+	if p.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return p.Status
+}
+
+func (p *Problem) publicMessage() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.title()
+}
+
+func (p *Problem) title() string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return http.StatusText(p.StatusCode())
+}
+
+// MarshalJSON encodes the problem members and its extensions
+// in a single object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	typ := p.Type
+	if typ == "" {
+		typ = "about:blank"
+	}
+	m["type"] = typ
+	m["title"] = p.title()
+	m["status"] = p.StatusCode()
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	} else {
+		delete(m, "detail")
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	} else {
+		delete(m, "instance")
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes a problem object, collecting unknown members
+// into Extensions.
+func (p *Problem) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for k, v := range m {
+		var err error
+		switch k {
+		case "type":
+			err = json.Unmarshal(v, &p.Type)
+		case "title":
+			err = json.Unmarshal(v, &p.Title)
+		case "status":
+			err = json.Unmarshal(v, &p.Status)
+		case "detail":
+			err = json.Unmarshal(v, &p.Detail)
+		case "instance":
+			err = json.Unmarshal(v, &p.Instance)
+		default:
+			var ext any
+			err = json.Unmarshal(v, &ext)
+			if p.Extensions == nil {
+				p.Extensions = map[string]any{}
+			}
+			p.Extensions[k] = ext
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProblemFromError returns the first *Problem in the chain of `err`, or
+// a Problem with the status and the public message of ErrorStatus.
+func ProblemFromError(err error) *Problem {
+	var pe publicError
+	if errors.As(err, &pe) {
+		if p, ok := pe.(*Problem); ok {
+			return p
+		}
+	}
+	status, msg := ErrorStatus(err)
+	p := NewProblem(status, "")
+	if msg != p.Title {
+		p.Detail = msg
+	}
+	return p
+}
+
+// WriteProblem writes `p` as `application/problem+json` when the client
+// accepts JSON, or as text/plain with the detail or the title otherwise.
+// Instance defaults to the request path.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	writeProblem(w, r, p, p.publicMessage(), false)
+}
+
+// writeProblem writes `p` as JSON when `forceJSON` is set or the client
+// accepts JSON, or as `text` otherwise.
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem, text string, forceJSON bool) {
+	if !forceJSON && !acceptsProblem(r) {
+		http.Error(w, text, p.StatusCode())
+		return
+	}
+	if p.Instance == "" {
+		cp := *p
+		cp.Instance = requestPath(r)
+		p = &cp
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, text, p.StatusCode())
+		return
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/problem+json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.StatusCode())
+	w.Write(append(b, '\n'))
+}
+
+// requestPath returns the path requested by the client, which is not
+// stripped by the mount points like r.URL.Path.
+func requestPath(r *http.Request) string {
+	if r.RequestURI != "" && r.RequestURI[0] == '/' {
+		p, _, _ := strings.Cut(r.RequestURI, "?")
+		return p
+	}
+	return r.URL.EscapedPath()
+}
+
+// acceptsProblem reports whether the client prefers a JSON problem to
+// text/plain. The client must list application/json or
+// application/problem+json explicitly, so clients sending no Accept header
+// or only wildcards like `*/*` get text/plain.
+func acceptsProblem(r *http.Request) bool {
+	accept := r.Header.Values("Accept")
+	if len(accept) == 0 {
+		return false
+	}
+	qJSON := 0.0
+	for _, mt := range []string{"application/problem+json", "application/json"} {
+		if q, exact := acceptQ(accept, mt); exact {
+			qJSON = max(qJSON, q)
+		}
+	}
+	qText, _ := acceptQ(accept, "text/plain")
+	return qJSON > 0 && qJSON >= qText
+}
+
+// acceptQ returns the quality of `mediaType` for the Accept header values,
+// taken from the most specific matching media range, or 0, and whether
+// the media type is listed itself rather than by a wildcard range.
+func acceptQ(accept []string, mediaType string) (float64, bool) {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, v := range accept {
+		for _, mr := range strings.Split(v, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(mr))
+			if err != nil {
+				continue
+			}
+			s := -1
+			switch {
+			case mt == mediaType:
+				s = 2
+			case mt == typ+"/*":
+				s = 1
+			case mt == "*/*":
+				s = 0
+			}
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1
+			if qs, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(qs, 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+	return q, specificity == 2
+}
+
+// notFoundHandler is the default 404 responder, answering like http.NotFound
+// clients that don't accept JSON problems.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, NewProblem(http.StatusNotFound, ""), "404 page not found", false)
+}
@@ -0,0 +1,132 @@
+package stdchi
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Name returns an inline-Router that names the route registered on it,
+// so URLs can be built for it with URL.
+func (mx *Mux) Name(name string) Router {
+	im := mx.With().(*Mux)
+	if name == "" {
+		mx.fail("", "", fmt.Errorf("stdchi: attempting to Name() a route with an empty name"))
+		return im
+	}
+	im.name = name
+	return im
+}
+
+// URL builds the URL path of the route registered as `name` anywhere along
+// the routing tree, including routes of mounted subrouters and their parents.
+// The `params` are key/value pairs filling the `{name}` and `{name...}`
+// wildcards of the full pattern, and a trailing `*` given as "*". Values
+// are escaped, a missing or unknown parameter, or a value not matching
+// its constraint, is an error. So is a name used by routes of several
+// subrouters.
+func (mx *Mux) URL(name string, params ...string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("stdchi: odd number of URL parameters for route '%s'", name)
+	}
+
+	top := mx
+	for top.parent != nil {
+		top = top.parent
+	}
+	patterns := top.namedPatterns(name, "", nil)
+	switch {
+	case len(patterns) == 0:
+		return "", fmt.Errorf("stdchi: route '%s' not found", name)
+	case len(patterns) > 1:
+		return "", fmt.Errorf("stdchi: route name '%s' is ambiguous, used by '%s' and '%s'", name, patterns[0], patterns[1])
+	}
+
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	return buildURL(patterns[0], values)
+}
+
+// namedPatterns appends the full patterns of the routes named `name` to
+// `patterns`, searching mounted subrouters too. Names are unique in each
+// Mux only, so several subrouters may use the same name.
+func (mx *Mux) namedPatterns(name, prefix string, patterns []string) []string {
+	for _, rt := range mx.base().routes {
+		if rt.name == name {
+			patterns = append(patterns, joinPatterns(prefix, rt.pattern))
+		}
+		if sub, ok := rt.subroutes.(*Mux); ok {
+			patterns = sub.namedPatterns(name, joinPatterns(prefix, rt.pattern), patterns)
+		}
+	}
+	for _, hr := range mx.base().hosts {
+		patterns = hr.mux.namedPatterns(name, joinPatterns(prefix, hr.pattern+"/"), patterns)
+	}
+	return patterns
+}
+
+// buildURL fills the wildcards of a pattern with escaped values.
+// Patterns with a host give a scheme-relative URL, `//host/path`.
+func buildURL(pattern string, values map[string]string) (string, error) {
+	used := make(map[string]bool, len(values))
+
+	var host string
+	if h, path, ok := splitHostPattern(pattern); ok {
+		labels := strings.Split(h, ".")
+		for i, l := range labels {
+			if ws := toWildcard(l); ws != "" {
+				if values[ws] == "" {
+					return "", fmt.Errorf("stdchi: missing URL parameter '%s' for '%s'", ws, pattern)
+				}
+				labels[i] = url.PathEscape(values[ws])
+				used[ws] = true
+			}
+		}
+		host, pattern = "//"+strings.Join(labels, "."), path
+	}
+
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		ws := toWildcard(seg)
+		rest := strings.HasSuffix(seg, "...}")
+		if seg == "*" && i == len(segs)-1 && i > 0 {
+			ws, rest = "*", true
+		}
+		switch {
+		case seg == "{$}":
+			segs[i] = ""
+		case ws == "":
+		case values[ws] == "":
+			return "", fmt.Errorf("stdchi: missing URL parameter '%s' for '%s'", ws, pattern)
+		case rest:
+			parts := strings.Split(values[ws], "/")
+			for j, p := range parts {
+				parts[j] = url.PathEscape(p)
+			}
+			segs[i] = strings.Join(parts, "/")
+			used[ws] = true
+		default:
+			if re, _ := toConstraint(seg); re != nil && !re.MatchString(values[ws]) {
+				return "", fmt.Errorf("stdchi: URL parameter '%s' doesn't match '%s'", ws, seg)
+			}
+			segs[i] = url.PathEscape(values[ws])
+			used[ws] = true
+		}
+	}
+
+	var extra []string
+	for k := range values {
+		if !used[k] {
+			extra = append(extra, k)
+		}
+	}
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		return "", fmt.Errorf("stdchi: unknown URL parameters %v for '%s'", extra, pattern)
+	}
+
+	return host + strings.Join(segs, "/"), nil
+}
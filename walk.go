@@ -0,0 +1,100 @@
+package stdchi
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Route describes the details of a routing handler.
+// Handlers map key is an HTTP method, "*" for routes matching any method.
+// Meta holds the metadata attached with Meta, keyed like Handlers.
+type Route struct {
+	SubRoutes Routes
+	Handlers  map[string]http.Handler
+	Pattern   string
+	Meta      map[string][]any
+}
+
+// route is a single registration on the routing tree of a Mux.
+type route struct {
+	method    string // empty for all methods
+	pattern   string
+	handler   http.Handler
+	mux       *Mux   // the (inline) Mux the route was registered on
+	subroutes Routes // set for Mount
+	name      string // set for routes registered through Name
+	meta      []any  // set for routes registered through Meta
+}
+
+// routesOf returns the Routes behind a mounted handler, looking through
+// handlers built with Chain.
+func routesOf(h http.Handler) Routes {
+	for {
+		switch v := h.(type) {
+		case Routes:
+			return v
+		case *ChainHandler:
+			h = v.Endpoint
+		default:
+			return nil
+		}
+	}
+}
+
+// WalkFunc is the type of the function called for each method and route visited by Walk.
+type WalkFunc func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error
+
+// Walk walks any router tree that implements Routes interface,
+// descending into subrouters attached with Mount or Route.
+// The route passed to walkFn is the full pattern along all mount levels.
+func Walk(r Routes, walkFn WalkFunc) error {
+	return walk(r, walkFn, "")
+}
+
+func walk(r Routes, walkFn WalkFunc, parentRoute string, parentMw ...func(http.Handler) http.Handler) error {
+	for _, route := range r.Routes() {
+		mws := make([]func(http.Handler) http.Handler, len(parentMw))
+		copy(mws, parentMw)
+		mws = append(mws, r.Middlewares()...)
+
+		fullRoute := joinPatterns(parentRoute, route.Pattern)
+
+		if route.SubRoutes != nil {
+			// Inline middlewares of the mount point apply to the subroutes.
+			if chain, ok := route.Handlers["*"].(*ChainHandler); ok {
+				mws = append(mws, chain.Middlewares...)
+			}
+			if err := walk(route.SubRoutes, walkFn, fullRoute, mws...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		methods := make([]string, 0, len(route.Handlers))
+		for method := range route.Handlers {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			handler := route.Handlers[method]
+			if chain, ok := handler.(*ChainHandler); ok {
+				if err := walkFn(method, fullRoute, chain.Endpoint, append(mws[:len(mws):len(mws)], chain.Middlewares...)...); err != nil {
+					return err
+				}
+			} else {
+				if err := walkFn(method, fullRoute, handler, mws...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// joinPatterns appends the pattern of a subrouter route to the pattern
+// the subrouter is mounted on.
+func joinPatterns(prefix, pattern string) string {
+	return strings.TrimSuffix(prefix, "/") + pattern
+}
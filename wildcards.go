@@ -2,21 +2,30 @@ package stdchi
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 )
 
 type wildcardCtx struct{}
 type wildcardValues map[string]string
 
+// withWildcards stores the path values in a context without routeCtx,
+// when StripSegments is used outside of a Mux.
 func withWildcards(ctx context.Context, wcs wildcardValues) context.Context {
 	return context.WithValue(ctx, wildcardCtx{}, wcs)
 }
 
+// wildcardsFromContext returns the path values captured so far. The map
+// must not be modified.
 func wildcardsFromContext(ctx context.Context) wildcardValues {
-	wcs, ok := ctx.Value(wildcardCtx{}).(wildcardValues)
-	if !ok {
-		wcs = wildcardValues{}
+	if rc := routeCtxFromContext(ctx); rc != nil {
+		_, values, _ := rc.state.get()
+		return values
 	}
+	wcs, _ := ctx.Value(wildcardCtx{}).(wildcardValues)
 	return wcs
 }
 
@@ -57,7 +66,113 @@ func toWildcard(s string) string {
 	if s == "{$}" {
 		return ""
 	}
-	return strings.TrimSuffix(s[1:len(s)-1], "...")
+	s = s[1 : len(s)-1]
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		return s[:i]
+	}
+	return strings.TrimSuffix(s, "...")
+}
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]string{
+		"int":   `-?[0-9]+`,
+		"uint":  `[0-9]+`,
+		"alpha": `[a-zA-Z]+`,
+		"alnum": `[a-zA-Z0-9]+`,
+		"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	}
+	constraintRegexps sync.Map // expression -> *regexp.Regexp
+)
+
+// RegisterConstraint adds a named shortcut for a wildcard regexp constraint,
+// used in patterns as `{id:name}`. Shortcuts int, uint, alpha, alnum and
+// uuid are predefined.
+func RegisterConstraint(name, expr string) {
+	if _, err := regexp.Compile(expr); err != nil {
+		panic(fmt.Sprintf("stdchi: invalid constraint '%s': %v", name, err))
+	}
+	constraintsMu.Lock()
+	constraints[name] = expr
+	constraintsMu.Unlock()
+}
+
+// ConstraintExpr returns the regexp of a constraint shortcut registered
+// with RegisterConstraint, or `expr` itself when it is not a shortcut.
+func ConstraintExpr(expr string) string {
+	constraintsMu.RLock()
+	defer constraintsMu.RUnlock()
+	if e, ok := constraints[expr]; ok {
+		return e
+	}
+	return expr
+}
+
+// toConstraint returns the regexp of a `{name:regexp}` or `{name:shortcut}`
+// wildcard segment, nil for segments without constraint.
+func toConstraint(s string) (*regexp.Regexp, error) {
+	if !(strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")) {
+		return nil, nil
+	}
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return nil, nil
+	}
+	expr := ConstraintExpr(s[i+1 : len(s)-1])
+
+	if re, ok := constraintRegexps.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	anchored := expr
+	if !strings.HasPrefix(anchored, "^") {
+		anchored = "^" + anchored
+	}
+	if !strings.HasSuffix(anchored, "$") {
+		anchored += "$"
+	}
+	re, err := regexp.Compile(anchored)
+	if err != nil {
+		return nil, err
+	}
+	constraintRegexps.Store(expr, re)
+	return re, nil
+}
+
+// pathConstraint is a regexp constraint on the value of a path wildcard.
+type pathConstraint struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// stdPattern converts chi pattern syntax to a http.ServeMux pattern:
+// `{name:regexp}` wildcards become `{name}` and their constraints are
+// returned, a trailing `/*` becomes `/`.
+//
+// As http.ServeMux doesn't see the constraints, sibling routes whose
+// wildcards differ by their constraints only, like `/a/{id:int}` and
+// `/a/{slug:alpha}`, conflict and can't be registered together.
+func stdPattern(pattern string) (string, []pathConstraint, error) {
+	if !strings.ContainsAny(pattern, ":*") {
+		return pattern, nil, nil
+	}
+	var cons []pathConstraint
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if seg == "*" && i == len(segs)-1 && i > 0 {
+			segs[i] = ""
+			continue
+		}
+		re, err := toConstraint(seg)
+		if err != nil {
+			return "", nil, fmt.Errorf("stdchi: invalid regexp in '%s' of '%s': %w", seg, pattern, err)
+		}
+		if re != nil {
+			name := toWildcard(seg)
+			cons = append(cons, pathConstraint{name: name, re: re})
+			segs[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segs, "/"), cons, nil
 }
 
 func stripToLastSlash(s string, cnt int) string {
@@ -73,3 +188,74 @@ func stripToLastSlash(s string, cnt int) string {
 	}
 	return s[pos:]
 }
+
+// matchPattern matches a path against a routing pattern and returns
+// the wildcard values. Unlike http.ServeMux it doesn't redirect, so
+// `/tree` doesn't match `/tree/`.
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	return matchSegments(pattern, path, false)
+}
+
+// matchURL matches the path of `u` against a routing pattern like
+// http.ServeMux does: the escaped path is split in segments, which are
+// unescaped, so an escaped slash doesn't end a wildcard value.
+func matchURL(pattern string, u *url.URL) (map[string]string, bool) {
+	return matchSegments(pattern, u.EscapedPath(), true)
+}
+
+func matchSegments(pattern, path string, escaped bool) (map[string]string, bool) {
+	if len(path) == 0 || path[0] != '/' {
+		return nil, false
+	}
+	unescape := func(s string) string {
+		if escaped {
+			if u, err := url.PathUnescape(s); err == nil {
+				return u
+			}
+		}
+		return s
+	}
+	params := map[string]string{}
+	segs := strings.Split(pattern[1:], "/")
+	rest := path[1:]
+	for i, ps := range segs {
+		last := i == len(segs)-1
+		if last {
+			switch {
+			case ps == "":
+				return params, true
+			case ps == "*":
+				params["*"] = unescape(rest)
+				return params, true
+			case ps == "{$}":
+				return params, rest == ""
+			case strings.HasPrefix(ps, "{") && strings.HasSuffix(ps, "...}"):
+				params[toWildcard(ps)] = unescape(rest)
+				return params, true
+			}
+		}
+
+		seg, tail, slash := strings.Cut(rest, "/")
+		seg = unescape(seg)
+		if ws := toWildcard(ps); ws != "" {
+			if seg == "" {
+				return nil, false
+			}
+			if re, _ := toConstraint(ps); re != nil && !re.MatchString(seg) {
+				return nil, false
+			}
+			params[ws] = seg
+		} else if seg != ps {
+			return nil, false
+		}
+
+		if last {
+			return params, !slash
+		}
+		if !slash {
+			return nil, false
+		}
+		rest = tail
+	}
+	return params, true
+}